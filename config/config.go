@@ -12,11 +12,42 @@ type RateLimitConfig struct {
 	IntervalMs int `validate:"required,gt=0" yaml:"intervalMs"`
 }
 
+type NyaaConfig struct {
+	BaseUrl  string   `validate:"required,url" yaml:"baseUrl"`
+	Mirrors  []string `validate:"dive,url" yaml:"mirrors"`
+	Category string   `validate:"required" yaml:"category"`
+	Filter   string   `validate:"oneof=none noRemakes trustedOnly" yaml:"filter"`
+}
+
+type AniListConfig struct {
+	ApiUrl string `validate:"required,url" yaml:"apiUrl"`
+}
+
+type MetadataConfig struct {
+	DefaultProvider string          `validate:"required" yaml:"defaultProvider"`
+	RateLimit       RateLimitConfig `yaml:"rateLimit"`
+	TimeoutMs       int             `validate:"gt=0" yaml:"timeoutMs"`
+	AniList         AniListConfig   `yaml:"anilist"`
+}
+
+type TorznabConfig struct {
+	BaseUrl    string `yaml:"baseUrl"`
+	ApiKey     string `yaml:"apiKey"`
+	Categories []int  `yaml:"categories"`
+	Limit      int    `validate:"gt=0" yaml:"limit"`
+}
+
 type SearchConfig struct {
-	Proxy          string          `yaml:"proxy"`
-	RateLimit      RateLimitConfig `yaml:"rateLimit"`
-	TimeoutMs      int             `yaml:"timeoutMs"`
-	RssIntervalSec int             `yaml:"rssIntervalSec"`
+	Proxy            string          `yaml:"proxy"`
+	RateLimit        RateLimitConfig `yaml:"rateLimit"`
+	TimeoutMs        int             `yaml:"timeoutMs"`
+	RssIntervalSec   int             `yaml:"rssIntervalSec"`
+	RssRetries       int             `validate:"gte=0" yaml:"rssRetries"`
+	TestQueryPages   int             `validate:"gte=0" yaml:"testQueryPages"`
+	BackfillMaxPages int             `validate:"gt=0" yaml:"backfillMaxPages"`
+	DefaultProvider  string          `validate:"required" yaml:"defaultProvider"`
+	Nyaa             NyaaConfig      `yaml:"nyaa"`
+	Torznab          TorznabConfig   `yaml:"torznab"`
 }
 
 type DbConfig struct {
@@ -44,11 +75,57 @@ type WebSocketConfig struct {
 	MessageChanBufferSize int   `validate:"required,gt=0" yaml:"messageChanBufferSize"`
 }
 
+// SeedingConfig Global seeding policy, can be overridden per series
+type SeedingConfig struct {
+	Mode       string  `validate:"oneof=none ratio time converted" yaml:"mode"`
+	Ratio      float64 `validate:"gte=0" yaml:"ratio"`
+	MinTimeSec int     `validate:"gte=0" yaml:"minTimeSec"`
+}
+
+// BandwidthScheduleConfig Limits applied between From and To (HH:MM, local time), zero means unlimited
+type BandwidthScheduleConfig struct {
+	From             string `validate:"required" yaml:"from"`
+	To               string `validate:"required" yaml:"to"`
+	DownloadBpsLimit int    `validate:"gte=0" yaml:"downloadBpsLimit"`
+	UploadBpsLimit   int    `validate:"gte=0" yaml:"uploadBpsLimit"`
+}
+
+// WatchRuleConfig Watch dir entries with names matching Pattern (regexp) are imported into the series
+type WatchRuleConfig struct {
+	Pattern  string `validate:"required" yaml:"pattern"`
+	SeriesId uint   `validate:"required" yaml:"seriesId"`
+}
+
+// WatchConfig Dir is polled for dropped .torrent files and videos, empty Dir disables watching
+type WatchConfig struct {
+	Dir         string            `yaml:"dir"`
+	IntervalSec int               `validate:"gt=0" yaml:"intervalSec"`
+	Auto        bool              `yaml:"auto"`      // Auto imports are downloaded and converted right away, like torrents found by series query
+	AudioLang   string            `yaml:"audioLang"` // AudioLang preferred audio language of auto conversions
+	SubLang     string            `yaml:"subLang"`   // SubLang preferred subtitle language of auto conversions
+	Rules       []WatchRuleConfig `validate:"dive" yaml:"rules"`
+}
+
+// RetentionConfig Source files of converted torrents are deleted from ready dir, zero values disable the rules
+type RetentionConfig struct {
+	KeepConvertedSec int   `validate:"gte=0" yaml:"keepConvertedSec"` // KeepConvertedSec sources are deleted this long after all their conversions are ready
+	MaxSourceBytes   int64 `validate:"gte=0" yaml:"maxSourceBytes"`   // MaxSourceBytes oldest converted sources are deleted while ready dir is bigger
+	IncludeLocal     bool  `yaml:"includeLocal"`                      // IncludeLocal sources of torrents imported from watch dir are deleted too
+}
+
 type DataConfig struct {
-	Dir              string `validate:"required" yaml:"dir"`
-	DownloadBpsLimit int    `validate:"gt=0" yaml:"downloadBpsLimit"`
-	UploadBpsLimit   int    `validate:"gt=0" yaml:"uploadBpsLimit"`
-	EpisodesPerPage  int    `validate:"gt=0" yaml:"episodesPerPage"`
+	Dir               string                    `validate:"required" yaml:"dir"`
+	DownloadBpsLimit  int                       `validate:"gt=0" yaml:"downloadBpsLimit"`
+	UploadBpsLimit    int                       `validate:"gt=0" yaml:"uploadBpsLimit"`
+	BandwidthSchedule []BandwidthScheduleConfig `validate:"dive" yaml:"bandwidthSchedule"`
+	EpisodesPerPage   int                       `validate:"gt=0" yaml:"episodesPerPage"`
+	MagnetTimeoutSec  int                       `validate:"gt=0" yaml:"magnetTimeoutSec"`
+	MaxDownloads      int                       `validate:"gt=0" yaml:"maxDownloads"`      // MaxDownloads number of simultaneously downloading torrents, others are queued
+	ProgressDbSaveSec int                       `validate:"gt=0" yaml:"progressDbSaveSec"` // ProgressDbSaveSec interval of saving progress to db, state changes are saved immediately. Pages poll progress from db, so it should stay short
+	MinFreeBytes      int64                     `validate:"gte=0" yaml:"minFreeBytes"`     // MinFreeBytes downloads are paused and new jobs are refused below this threshold
+	Seeding           SeedingConfig             `yaml:"seeding"`
+	Watch             WatchConfig               `yaml:"watch"`
+	Retention         RetentionConfig           `yaml:"retention"`
 }
 
 type FFMpegConfig struct {
@@ -92,6 +169,7 @@ type Config struct {
 	Data      DataConfig      `validate:"dive,required" yaml:"data"`
 	FFMpeg    FFMpegConfig    `validate:"dive,required" yaml:"ffmpeg"`
 	Search    SearchConfig    `validate:"dive,required" yaml:"search"`
+	Metadata  MetadataConfig  `validate:"dive,required" yaml:"metadata"`
 	Thumb     ThumbConfig     `validate:"dive,required" yaml:"thumb"`
 	User      UserConfig      `validate:"dive,required" yaml:"user"`
 	Admin     AdminConfig     `validate:"dive,required" yaml:"admin"`
@@ -123,10 +201,22 @@ func GetDefaultConfig() Config {
 			MessageChanBufferSize: 256,
 		},
 		Data: DataConfig{
-			Dir:              "data",
-			DownloadBpsLimit: 5 * 1024 * 1024,
-			UploadBpsLimit:   1024 * 1024,
-			EpisodesPerPage:  20,
+			Dir:               "data",
+			DownloadBpsLimit:  5 * 1024 * 1024,
+			UploadBpsLimit:    1024 * 1024,
+			EpisodesPerPage:   20,
+			MagnetTimeoutSec:  600,
+			MaxDownloads:      2,
+			ProgressDbSaveSec: 3,
+			MinFreeBytes:      5 * 1024 * 1024 * 1024,
+			Seeding: SeedingConfig{
+				Mode:       "none",
+				Ratio:      1,
+				MinTimeSec: 24 * 60 * 60,
+			},
+			Watch: WatchConfig{
+				IntervalSec: 30,
+			},
 		},
 		FFMpeg: FFMpegConfig{
 			StreamSizeArgs: "$BASE -analyzeduration $MAX -probesize $MAX -i $INPUT -map $MAP -c copy -f null -",
@@ -139,8 +229,32 @@ func GetDefaultConfig() Config {
 				Requests:   1,
 				IntervalMs: 5000,
 			},
-			TimeoutMs:      10000,
-			RssIntervalSec: 1800,
+			TimeoutMs:        10000,
+			RssIntervalSec:   1800,
+			RssRetries:       5,
+			TestQueryPages:   2,
+			BackfillMaxPages: 10,
+			DefaultProvider:  "nyaa",
+			Nyaa: NyaaConfig{
+				BaseUrl:  "https://nyaa.si",
+				Category: "1_0",
+				Filter:   "none",
+			},
+			Torznab: TorznabConfig{
+				Categories: []int{5070},
+				Limit:      100,
+			},
+		},
+		Metadata: MetadataConfig{
+			DefaultProvider: "anilist",
+			RateLimit: RateLimitConfig{
+				Requests:   1,
+				IntervalMs: 1000,
+			},
+			TimeoutMs: 10000,
+			AniList: AniListConfig{
+				ApiUrl: "https://graphql.anilist.co",
+			},
 		},
 		Thumb: ThumbConfig{
 			Args:     "$BASE -ss $SS -i $INPUT -frames:v 1 $OUTPUT",
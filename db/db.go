@@ -30,7 +30,16 @@ func initDB(config *config.Config) (*gorm.DB, error) {
 		return nil, err
 	}
 
-	err = db.AutoMigrate(&Series{}, &Torrent{}, &TorrentFile{}, &User{}, &Conversion{}, &Episode{}, &LastRSSUpdate{})
+	if err := migrateTorrentInfoHash(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate torrent info hash: %w", err)
+	}
+
+	if err := migratePendingRSSItems(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate pending rss items: %w", err)
+	}
+
+	err = db.AutoMigrate(&Series{}, &Torrent{}, &TorrentFile{}, &User{}, &Conversion{}, &Episode{}, &LastRSSUpdate{},
+		&PendingRSSItem{})
 	if err != nil {
 		return nil, err
 	}
@@ -47,4 +56,32 @@ func initDB(config *config.Config) (*gorm.DB, error) {
 	return db, nil
 }
 
+// migrateTorrentInfoHash Info hash became unique, so duplicates of the oldest torrent are left without info hash
+// before the unique index is created, the old non-unique index is dropped
+func migrateTorrentInfoHash(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&Torrent{}) || migrator.HasIndex(&Torrent{}, "idx_torrents_info_hash_unique") {
+		return nil
+	}
+	if err := db.Exec(`UPDATE torrents SET info_hash = '' WHERE info_hash <> '' AND id NOT IN
+		(SELECT MIN(id) FROM torrents WHERE info_hash <> '' GROUP BY info_hash)`).Error; err != nil {
+		return err
+	}
+	if migrator.HasIndex(&Torrent{}, "idx_torrents_info_hash") {
+		return migrator.DropIndex(&Torrent{}, "idx_torrents_info_hash")
+	}
+	return nil
+}
+
+// migratePendingRSSItems Pending items became unique per series and provider, so only the oldest copy is kept
+// before the unique index is created
+func migratePendingRSSItems(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&PendingRSSItem{}) || migrator.HasIndex(&PendingRSSItem{}, "idx_pending_rss_items_item") {
+		return nil
+	}
+	return db.Exec(`DELETE FROM pending_rss_items WHERE id NOT IN
+		(SELECT MIN(id) FROM pending_rss_items GROUP BY series_id, provider, rss_id)`).Error
+}
+
 var ServiceExport = fx.Options(fx.Provide(initDB))
@@ -1,6 +1,9 @@
 package db
 
-import "os"
+import (
+	"os"
+	"time"
+)
 
 type AuthUser struct {
 	ID    uint     `json:"id"`
@@ -23,6 +26,43 @@ func (t *Thumb) Delete() {
 	_ = os.Remove(t.Path)
 }
 
+// SeriesMetadata Info fetched from external anime catalog
+type SeriesMetadata struct {
+	Provider      string         `json:"provider"`
+	ExternalId    string         `json:"externalId"`
+	Title         string         `json:"title"`
+	AltTitles     []string       `json:"altTitles"`
+	Synopsis      string         `json:"synopsis"`
+	Year          int            `json:"year"`
+	Season        string         `json:"season"`
+	Genres        []string       `json:"genres"`
+	TotalEpisodes int            `json:"totalEpisodes"`
+	Poster        string         `json:"poster"`
+	Episodes      []EpisodeTitle `json:"episodes"`
+	UpdatedAt     time.Time      `json:"updatedAt"`
+}
+
+type EpisodeTitle struct {
+	Episode string `json:"episode"`
+	Title   string `json:"title"`
+}
+
+type SeedingMode string
+
+const (
+	SeedingNone      SeedingMode = "none"
+	SeedingRatio     SeedingMode = "ratio"
+	SeedingTime      SeedingMode = "time"
+	SeedingConverted SeedingMode = "converted"
+)
+
+// SeedingPolicy Decides for how long torrent is seeded after download completion
+type SeedingPolicy struct {
+	Mode       SeedingMode `json:"mode"`
+	Ratio      float64     `json:"ratio"`      // Ratio target upload ratio for SeedingRatio
+	MinTimeSec int         `json:"minTimeSec"` // MinTimeSec seeding duration for SeedingTime, and for SeedingConverted torrents that have no conversions
+}
+
 type AutoTorrent struct {
 	AudioLang string `json:"audioLang"`
 	SubLang   string `json:"subLang"`
@@ -66,10 +106,29 @@ type AnalysisResult struct {
 	Sub   []SubStream   `json:"sub"`
 }
 
+// ReleaseScoring Preferences used to pick the best release of an episode, earlier list entries are preferred
+type ReleaseScoring struct {
+	Groups      []string `json:"groups"`
+	Resolutions []string `json:"resolutions"`
+	Codecs      []string `json:"codecs"`
+	PreferV2    bool     `json:"preferV2"`
+}
+
 type SeriesQuery struct {
-	Include    []string    `json:"include"`
-	Exclude    []string    `json:"exclude"`
-	Provider   string      `json:"provider"`
-	SingleFile bool        `json:"singleFile"`
-	Auto       AutoTorrent `json:"auto"`
+	Include      []string          `json:"include"`
+	Exclude      []string          `json:"exclude"`
+	IncludeRegex string            `json:"includeRegex"`
+	ExcludeRegex string            `json:"excludeRegex"`
+	MinEpisode   *float64          `json:"minEpisode"`
+	MaxEpisode   *float64          `json:"maxEpisode"`
+	Scoring      *ReleaseScoring   `json:"scoring"`
+	Provider     string            `json:"provider"`
+	Category     string            `json:"category"`
+	SiteFilter   string            `json:"siteFilter"`
+	FeedUrl      string            `json:"feedUrl"`
+	FeedParams   map[string]string `json:"feedParams"`
+	SingleFile   bool              `json:"singleFile"`
+	TrustedOnly  bool              `json:"trustedOnly"`
+	MinSeeders   int               `json:"minSeeders"`
+	Auto         AutoTorrent       `json:"auto"`
 }
@@ -14,7 +14,10 @@ type Series struct {
 	LastUpdate time.Time
 	Title      string
 	Query      *datatypes.JSONType[SeriesQuery]
-	Thumb      Thumb `gorm:"embedded"`
+	Metadata   *datatypes.JSONType[SeriesMetadata]
+	Seeding    *datatypes.JSONType[SeedingPolicy] // Seeding overrides global seeding policy for torrents of the series
+	Archive    bool                               // Archive sources of the series are kept regardless of retention policy
+	Thumb      Thumb                              `gorm:"embedded"`
 }
 
 type TorrentStatus string
@@ -22,10 +25,12 @@ type TorrentStatus string
 const (
 	TorrentCreating TorrentStatus = "creating"
 	TorrentIdle     TorrentStatus = "idle"
+	TorrentQueued   TorrentStatus = "queued"
 	TorrentDownload TorrentStatus = "download"
 	TorrentAnalysis TorrentStatus = "analysis"
 	TorrentError    TorrentStatus = "error"
 	TorrentReady    TorrentStatus = "ready"
+	TorrentCleaned  TorrentStatus = "cleaned" // TorrentCleaned all source files were deleted by retention policy
 )
 
 type Torrent struct {
@@ -38,14 +43,32 @@ type Torrent struct {
 
 	Auto                datatypes.JSONType[*AutoTorrent]
 	FilePath            string // FilePath path to .torrent file
+	InfoHash            string `gorm:"uniqueIndex:idx_torrents_info_hash_unique,where:info_hash <> ''"`
 	Name                string
 	BytesRead           uint
+	BytesUploaded       uint
 	TotalLength         uint
 	TotalDownloadLength uint
 	util.Progress       `gorm:"embedded"`
 	Status              TorrentStatus
-	Source              *string       // Source link to torrent url in case it was added automatically via query
-	Files               []TorrentFile `gorm:"foreignKey:torrent_id;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Priority            int                                   // Priority queued torrents with higher priority are downloaded first
+	QueueOrder          int                                   // QueueOrder position in download queue among torrents with the same priority
+	DownloadBpsLimit    int                                   // DownloadBpsLimit per-torrent download cap, zero means no cap
+	UploadBpsLimit      int                                   // UploadBpsLimit per-torrent upload cap, zero means no cap
+	Source              *string                               // Source link to torrent url in case it was added automatically via query
+	Release             datatypes.JSONType[*meta.ReleaseInfo] // Release info parsed from title in case it was added automatically via query
+	Seeding             bool                                  // Seeding torrent is kept in client after completion until its SeedingPolicy is satisfied
+	SeedingSince        *time.Time                            // SeedingSince start of seeding, counted across restarts
+	Local               bool                                  // Local torrent was imported from watch dir, it has no .torrent file and is never downloaded
+	Files               []TorrentFile                         `gorm:"foreignKey:torrent_id;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+// Ratio Uploaded to downloaded bytes ratio
+func (t *Torrent) Ratio() float64 {
+	if t.BytesRead == 0 {
+		return 0
+	}
+	return float64(t.BytesUploaded) / float64(t.BytesRead)
 }
 
 type TorrentFileStatus string
@@ -56,6 +79,7 @@ const (
 	TorrentFileAnalysis TorrentFileStatus = "analysis"
 	TorrentFileError    TorrentFileStatus = "error"
 	TorrentFileReady    TorrentFileStatus = "ready"
+	TorrentFileDeleted  TorrentFileStatus = "deleted" // TorrentFileDeleted source file was deleted by retention policy, it can be downloaded again
 )
 
 // TorrentFile Represents info about a single torrent file
@@ -148,8 +172,25 @@ type User struct {
 	Thumb     Thumb `gorm:"embedded"`
 }
 
+// LastRSSUpdate Position of the last processed item in a single RSS feed
 type LastRSSUpdate struct {
-	ID        uint `gorm:"primarykey"`
+	ID        uint   `gorm:"primarykey"`
+	Provider  string `gorm:"uniqueIndex:idx_last_rss_update_feed"`
+	FeedUrl   string `gorm:"uniqueIndex:idx_last_rss_update_feed"`
 	Timestamp time.Time
 	RssId     string
 }
+
+// PendingRSSItem RSS item that matched series query, but failed to be added, it is retried on the next poll
+type PendingRSSItem struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	SeriesId  uint   `gorm:"uniqueIndex:idx_pending_rss_items_item"`
+	Series    Series `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Provider  string `gorm:"uniqueIndex:idx_pending_rss_items_item"`
+	RssId     string `gorm:"uniqueIndex:idx_pending_rss_items_item"`
+	Title     string
+	Link      string
+	Attempts  int
+}
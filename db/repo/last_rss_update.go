@@ -5,6 +5,7 @@ import (
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type LastRSSRepo struct {
@@ -19,25 +20,41 @@ func NewLastRSSRepo(db *gorm.DB, log *zap.Logger) *LastRSSRepo {
 	}
 }
 
-func (r *LastRSSRepo) GetLast() (db.LastRSSUpdate, error) {
-	entry := db.LastRSSUpdate{
-		ID: 1,
+// GetLast Returns cursor of the given feed, feeds that were never polled
+// start from the legacy global cursor (empty provider and url), if it exists
+func (r *LastRSSRepo) GetLast(provider string, feedUrl string) (db.LastRSSUpdate, error) {
+	var entry db.LastRSSUpdate
+	queryResult := r.db.Where("provider = ? AND feed_url = ?", provider, feedUrl).Limit(1).Find(&entry)
+	if queryResult.Error != nil {
+		return db.LastRSSUpdate{}, queryResult.Error
 	}
-	if err := r.db.FirstOrCreate(&entry, db.LastRSSUpdate{
-		ID: 1,
-	}).Error; err != nil {
+	if queryResult.RowsAffected > 0 {
+		return entry, nil
+	}
+
+	var legacy db.LastRSSUpdate
+	if err := r.db.Where("provider = ? AND feed_url = ?", "", "").Limit(1).Find(&legacy).Error; err != nil {
 		return db.LastRSSUpdate{}, err
 	}
-	return entry, nil
+
+	return db.LastRSSUpdate{
+		Provider:  provider,
+		FeedUrl:   feedUrl,
+		Timestamp: legacy.Timestamp,
+		RssId:     legacy.RssId,
+	}, nil
 }
 
 func (r *LastRSSRepo) SetLast(newEntry db.LastRSSUpdate) error {
-	return r.db.Model(&db.LastRSSUpdate{}).
-		Where("id = ?", 1).
-		Updates(db.LastRSSUpdate{
-			Timestamp: newEntry.Timestamp,
-			RssId:     newEntry.RssId,
-		}).Error
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "provider"}, {Name: "feed_url"}},
+		DoUpdates: clause.AssignmentColumns([]string{"timestamp", "rss_id"}),
+	}).Create(&db.LastRSSUpdate{
+		Provider:  newEntry.Provider,
+		FeedUrl:   newEntry.FeedUrl,
+		Timestamp: newEntry.Timestamp,
+		RssId:     newEntry.RssId,
+	}).Error
 }
 
 var LastRSSExport = fx.Options(fx.Provide(NewLastRSSRepo))
@@ -0,0 +1,60 @@
+package repo
+
+import (
+	"anileha/db"
+	"errors"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type PendingRSSRepo struct {
+	db  *gorm.DB
+	log *zap.Logger
+}
+
+func NewPendingRSSRepo(db *gorm.DB, log *zap.Logger) *PendingRSSRepo {
+	return &PendingRSSRepo{
+		db:  db,
+		log: log,
+	}
+}
+
+func (r *PendingRSSRepo) GetAll() ([]db.PendingRSSItem, error) {
+	var items []db.PendingRSSItem
+	queryResult := r.db.Order("created_at ASC").Find(&items)
+	if queryResult.Error != nil {
+		return nil, queryResult.Error
+	}
+	return items, nil
+}
+
+// Add Stores failed item, items that are already pending are left as is,
+// including the ones added concurrently after the lookup
+func (r *PendingRSSRepo) Add(item *db.PendingRSSItem) error {
+	err := r.db.Where(db.PendingRSSItem{
+		SeriesId: item.SeriesId,
+		Provider: item.Provider,
+		RssId:    item.RssId,
+	}).FirstOrCreate(item).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil
+	}
+	return err
+}
+
+func (r *PendingRSSRepo) SetAttempts(id uint, attempts int) error {
+	return r.db.Model(&db.PendingRSSItem{}).
+		Where("id = ?", id).
+		Update("attempts", attempts).Error
+}
+
+func (r *PendingRSSRepo) DeleteById(id uint) (int64, error) {
+	queryResult := r.db.Delete(&db.PendingRSSItem{}, id)
+	if queryResult.Error != nil {
+		return 0, queryResult.Error
+	}
+	return queryResult.RowsAffected, nil
+}
+
+var PendingRSSExport = fx.Options(fx.Provide(NewPendingRSSRepo))
@@ -87,6 +87,31 @@ func (r *SeriesRepo) SetQuery(id uint, query *db.SeriesQuery) error {
 		Updates(map[string]any{"query": nil}).Error
 }
 
+func (r *SeriesRepo) SetSeedingPolicy(id uint, policy *db.SeedingPolicy) error {
+	if policy != nil {
+		newJson := datatypes.NewJSONType(*policy)
+		return r.db.Model(&db.Series{}).
+			Where("id = ?", id).
+			Updates(db.Series{Seeding: &newJson}).Error
+	}
+	return r.db.Model(&db.Series{}).
+		Where("id = ?", id).
+		Updates(map[string]any{"seeding": nil}).Error
+}
+
+func (r *SeriesRepo) SetArchive(id uint, archive bool) error {
+	return r.db.Model(&db.Series{}).
+		Where("id = ?", id).
+		Updates(map[string]any{"archive": archive}).Error
+}
+
+func (r *SeriesRepo) SetMetadata(id uint, metadata db.SeriesMetadata) error {
+	newJson := datatypes.NewJSONType(metadata)
+	return r.db.Model(&db.Series{}).
+		Where("id = ?", id).
+		Updates(db.Series{Metadata: &newJson}).Error
+}
+
 func (r *SeriesRepo) MoveToTop(id uint) error {
 	return r.db.Model(&db.Series{}).
 		Where("id = ?", id).
@@ -4,10 +4,12 @@ import (
 	"anileha/db"
 	"anileha/rest/engine"
 	"anileha/util"
+	"errors"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"time"
 )
 
 type TorrentRepo struct {
@@ -22,15 +24,17 @@ func NewTorrentRepo(db *gorm.DB, log *zap.Logger) *TorrentRepo {
 	}
 }
 
-func (r *TorrentRepo) ResetDownloadStatus() error {
+// ResetInterruptedStatus Marks torrents interrupted by restart as failed, downloads are kept to be resumed
+func (r *TorrentRepo) ResetInterruptedStatus() error {
 	return r.db.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Model(&db.Torrent{}).
-			Where("status = ? or status = ? or status = ?", db.TorrentDownload, db.TorrentCreating, db.TorrentAnalysis).
+			Where("status = ? or status = ?", db.TorrentCreating, db.TorrentAnalysis).
 			Updates(db.Torrent{Status: db.TorrentError}).Error; err != nil {
 			return err
 		}
 		if err := tx.Model(&db.TorrentFile{}).
-			Where("status = ?", db.TorrentFileDownload).
+			Where("status = ? and torrent_id not in (?)", db.TorrentFileDownload,
+				tx.Model(&db.Torrent{}).Select("id").Where("status = ?", db.TorrentDownload)).
 			Updates(map[string]interface{}{"status": db.TorrentFileError, "selected": false}).Error; err != nil {
 			return err
 		}
@@ -38,6 +42,86 @@ func (r *TorrentRepo) ResetDownloadStatus() error {
 	})
 }
 
+// GetSeeding Returns torrents that were seeding before restart, along with their series
+func (r *TorrentRepo) GetSeeding() ([]db.Torrent, error) {
+	var torrentArr []db.Torrent
+	queryResult := r.db.Preload("Files", func(db *gorm.DB) *gorm.DB {
+		return db.Order("torrent_files.client_index ASC")
+	}).Preload("Series").
+		Where("seeding = ?", true).
+		Find(&torrentArr)
+	if queryResult.Error != nil {
+		return nil, queryResult.Error
+	}
+	return torrentArr, nil
+}
+
+// RequeueDownloading Puts torrents that were downloading before restart back to the queue
+func (r *TorrentRepo) RequeueDownloading() error {
+	return r.db.Model(&db.Torrent{}).
+		Where("status = ?", db.TorrentDownload).
+		Updates(db.Torrent{Status: db.TorrentQueued}).Error
+}
+
+// GetQueued Returns queued torrents in download order
+func (r *TorrentRepo) GetQueued() ([]db.Torrent, error) {
+	var torrentArr []db.Torrent
+	queryResult := r.db.Preload("Files", func(db *gorm.DB) *gorm.DB {
+		return db.Order("torrent_files.client_index ASC")
+	}).Where("status = ?", db.TorrentQueued).
+		Order("torrents.priority DESC, torrents.queue_order ASC, torrents.id ASC").
+		Find(&torrentArr)
+	if queryResult.Error != nil {
+		return nil, queryResult.Error
+	}
+	return torrentArr, nil
+}
+
+func (r *TorrentRepo) CountByStatus(status db.TorrentStatus) (int64, error) {
+	var count int64
+	if err := r.db.Model(&db.Torrent{}).Where("status = ?", status).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (r *TorrentRepo) SetPriority(id uint, priority int) error {
+	return r.db.Model(&db.Torrent{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"priority": priority}).Error
+}
+
+func (r *TorrentRepo) SetBandwidth(id uint, downloadBpsLimit int, uploadBpsLimit int) error {
+	return r.db.Model(&db.Torrent{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"download_bps_limit": downloadBpsLimit, "upload_bps_limit": uploadBpsLimit}).Error
+}
+
+// GetCapped Returns torrents with per-torrent bandwidth caps
+func (r *TorrentRepo) GetCapped() ([]db.Torrent, error) {
+	var torrentArr []db.Torrent
+	queryResult := r.db.Where("download_bps_limit > 0 OR upload_bps_limit > 0").Find(&torrentArr)
+	if queryResult.Error != nil {
+		return nil, queryResult.Error
+	}
+	return torrentArr, nil
+}
+
+// SetQueueOrder Orders torrents with the given ids as listed
+func (r *TorrentRepo) SetQueueOrder(ids []uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for i, id := range ids {
+			err := tx.Model(&db.Torrent{}).
+				Where("id = ?", id).
+				Updates(map[string]interface{}{"queue_order": i + 1}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (r *TorrentRepo) DeleteById(id uint) error {
 	return r.db.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Delete(&db.TorrentFile{}, "torrent_id = ?", id).Error; err != nil {
@@ -116,16 +200,35 @@ func (r *TorrentRepo) UpdateProgress(id uint, progress util.Progress) error {
 	return nil
 }
 
-func (r *TorrentRepo) UpdateProgressAndBytesRead(id uint, progress util.Progress, bytesRead uint) error {
+func (r *TorrentRepo) UpdateProgressAndBytes(id uint, progress util.Progress, bytesRead uint, bytesUploaded uint) error {
 	if err := r.db.Model(&db.Torrent{}).
 		Where("id = ?", id).
-		Updates(db.Torrent{Progress: progress, BytesRead: bytesRead}).Error; err != nil {
+		Updates(db.Torrent{Progress: progress, BytesRead: bytesRead, BytesUploaded: bytesUploaded}).Error; err != nil {
 		return err
 	}
 
 	return nil
 }
 
+func (r *TorrentRepo) SetBytesUploaded(id uint, bytesUploaded uint) error {
+	return r.db.Model(&db.Torrent{}).
+		Where("id = ?", id).
+		Updates(db.Torrent{BytesUploaded: bytesUploaded}).Error
+}
+
+func (r *TorrentRepo) StartSeeding(id uint) error {
+	now := time.Now()
+	return r.db.Model(&db.Torrent{}).
+		Where("id = ?", id).
+		Updates(db.Torrent{Seeding: true, SeedingSince: &now}).Error
+}
+
+func (r *TorrentRepo) StopSeeding(id uint) error {
+	return r.db.Model(&db.Torrent{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"seeding": false, "seeding_since": nil}).Error
+}
+
 func (r *TorrentRepo) GetById(id uint, preloadSeries bool) (*db.Torrent, error) {
 	var torrent db.Torrent
 	builder := r.db.Preload("Files", func(db *gorm.DB) *gorm.DB {
@@ -144,6 +247,38 @@ func (r *TorrentRepo) GetById(id uint, preloadSeries bool) (*db.Torrent, error)
 	return &torrent, nil
 }
 
+// GetReady Returns ready torrents along with their series
+func (r *TorrentRepo) GetReady() ([]db.Torrent, error) {
+	var torrentArr []db.Torrent
+	queryResult := r.db.Preload("Files", func(db *gorm.DB) *gorm.DB {
+		return db.Order("torrent_files.client_index ASC")
+	}).Preload("Series").
+		Where("status = ?", db.TorrentReady).
+		Find(&torrentArr)
+	if queryResult.Error != nil {
+		return nil, queryResult.Error
+	}
+	return torrentArr, nil
+}
+
+// DeleteSources Marks files as deleted, torrent is marked cleaned once it has no source files left
+func (r *TorrentRepo) DeleteSources(id uint, fileIds []uint, cleaned bool) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&db.TorrentFile{}).
+			Where("id IN ?", fileIds).
+			Updates(map[string]interface{}{"ready_path": nil, "status": db.TorrentFileDeleted}).Error
+		if err != nil {
+			return err
+		}
+		if !cleaned {
+			return nil
+		}
+		return tx.Model(&db.Torrent{}).
+			Where("id = ?", id).
+			Updates(db.Torrent{Status: db.TorrentCleaned}).Error
+	})
+}
+
 func (r *TorrentRepo) GetBySeriesId(seriesId uint) ([]db.Torrent, error) {
 	var torrentArr []db.Torrent
 	queryResult := r.db.
@@ -167,6 +302,43 @@ func (r *TorrentRepo) GetAll() ([]db.Torrent, error) {
 	return torrentArr, nil
 }
 
+// GetExisting Returns torrent with the same info hash or source, empty values are ignored
+func (r *TorrentRepo) GetExisting(infoHash string, source string) (*db.Torrent, error) {
+	var torrent db.Torrent
+	queryResult := r.db.
+		Where("(info_hash <> '' AND info_hash = ?) OR (source <> '' AND source = ?)", infoHash, source).
+		Limit(1).
+		Find(&torrent)
+	if queryResult.Error != nil {
+		return nil, queryResult.Error
+	}
+	if queryResult.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &torrent, nil
+}
+
+// GetWithoutInfoHash Local torrents have no .torrent file to compute info hash from
+func (r *TorrentRepo) GetWithoutInfoHash() ([]db.Torrent, error) {
+	var torrentArr []db.Torrent
+	queryResult := r.db.Where("(info_hash = ? OR info_hash IS NULL) AND local = ?", "", false).Find(&torrentArr)
+	if queryResult.Error != nil {
+		return nil, queryResult.Error
+	}
+	return torrentArr, nil
+}
+
+// SetInfoHash Returns engine.ErrTorrentAlreadyExists if another torrent has the same info hash
+func (r *TorrentRepo) SetInfoHash(id uint, infoHash string) error {
+	err := r.db.Model(&db.Torrent{}).
+		Where("id = ?", id).
+		Updates(db.Torrent{InfoHash: infoHash}).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return engine.ErrTorrentAlreadyExists
+	}
+	return err
+}
+
 func (r *TorrentRepo) InitFiles(torrent db.Torrent, files []db.TorrentFile) error {
 	return r.db.Transaction(func(tx *gorm.DB) error {
 		queryResult := tx.Create(files)
@@ -186,34 +358,98 @@ func (r *TorrentRepo) InitFiles(torrent db.Torrent, files []db.TorrentFile) erro
 	})
 }
 
+// QueueTorrent Selects files to download and puts torrent to the end of the download queue
+func (r *TorrentRepo) QueueTorrent(id uint, unselectedIds []uint, selectedIds []uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var lastOrder int
+		err := tx.Model(&db.Torrent{}).
+			Where("status = ?", db.TorrentQueued).
+			Select("COALESCE(MAX(queue_order), 0)").
+			Scan(&lastOrder).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&db.Torrent{}).
+			Where("id = ?", id).
+			Updates(map[string]interface{}{
+				"status":                db.TorrentQueued,
+				"queue_order":           lastOrder + 1,
+				"total_download_length": 0,
+				"seeding":               false,
+				"seeding_since":         nil,
+			}).Error
+		if err != nil {
+			return err
+		}
+		if err := selectFiles(tx, unselectedIds, false, db.TorrentFileIdle); err != nil {
+			return err
+		}
+		return selectFiles(tx, selectedIds, true, db.TorrentFileIdle)
+	})
+}
+
 func (r *TorrentRepo) StartTorrent(id uint, unselectedIds []uint, selectedIds []uint, downloadLength uint) error {
 	return r.db.Transaction(func(tx *gorm.DB) error {
 		err := tx.Model(&db.Torrent{}).
 			Where("id = ?", id).
-			Updates(db.Torrent{Status: db.TorrentDownload, TotalDownloadLength: downloadLength}).Error
+			Updates(map[string]interface{}{
+				"status":                db.TorrentDownload,
+				"total_download_length": downloadLength,
+				"seeding":               false,
+				"seeding_since":         nil,
+			}).Error
 		if err != nil {
 			return err
 		}
-		for _, id := range unselectedIds {
-			err = tx.Model(&db.TorrentFile{}).
-				Where("id = ?", id).
-				Updates(map[string]interface{}{"status": db.TorrentFileIdle, "selected": false}).Error
-			if err != nil {
-				return err
-			}
+		if err := selectFiles(tx, unselectedIds, false, db.TorrentFileIdle); err != nil {
+			return err
 		}
-		for _, id := range selectedIds {
-			err = tx.Model(&db.TorrentFile{}).
-				Where("id = ?", id).
-				Updates(map[string]interface{}{"status": db.TorrentFileDownload, "selected": true}).Error
-			if err != nil {
-				return err
-			}
+		return selectFiles(tx, selectedIds, true, db.TorrentFileDownload)
+	})
+}
+
+// UpdateSelection Changes selection of an active download, other files are not touched
+func (r *TorrentRepo) UpdateSelection(id uint, addedIds []uint, removedIds []uint, downloadLength uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&db.Torrent{}).
+			Where("id = ?", id).
+			Update("total_download_length", downloadLength).Error
+		if err != nil {
+			return err
 		}
-		return nil
+		if err := selectFiles(tx, removedIds, false, db.TorrentFileIdle); err != nil {
+			return err
+		}
+		return selectFiles(tx, addedIds, true, db.TorrentFileDownload)
 	})
 }
 
+// SetQueuedSelection Changes selected files of a queued torrent
+func (r *TorrentRepo) SetQueuedSelection(addedIds []uint, removedIds []uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := selectFiles(tx, removedIds, false, db.TorrentFileIdle); err != nil {
+			return err
+		}
+		return selectFiles(tx, addedIds, true, db.TorrentFileIdle)
+	})
+}
+
+// selectFiles Files that are already ready keep their status, so that they are not downloaded or analyzed again
+func selectFiles(tx *gorm.DB, ids []uint, selected bool, status db.TorrentFileStatus) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	err := tx.Model(&db.TorrentFile{}).
+		Where("id IN ?", ids).
+		Update("selected", selected).Error
+	if err != nil {
+		return err
+	}
+	return tx.Model(&db.TorrentFile{}).
+		Where("id IN ? AND ready_path IS NULL", ids).
+		Update("status", status).Error
+}
+
 func (r *TorrentRepo) StopTorrent(id uint) error {
 	return r.db.Transaction(func(tx *gorm.DB) error {
 		err := tx.Model(&db.Torrent{}).
@@ -224,7 +460,13 @@ func (r *TorrentRepo) StopTorrent(id uint) error {
 		}
 		err = tx.Model(&db.TorrentFile{}).
 			Where("torrent_id = ?", id).
-			Updates(map[string]interface{}{"status": db.TorrentFileIdle, "selected": false}).Error
+			Update("selected", false).Error
+		if err != nil {
+			return engine.ErrInternal(err.Error())
+		}
+		err = tx.Model(&db.TorrentFile{}).
+			Where("torrent_id = ? AND ready_path IS NULL", id).
+			Update("status", db.TorrentFileIdle).Error
 		if err != nil {
 			return engine.ErrInternal(err.Error())
 		}
@@ -232,8 +474,12 @@ func (r *TorrentRepo) StopTorrent(id uint) error {
 	})
 }
 
+// Create Returns engine.ErrTorrentAlreadyExists if torrent with the same info hash was created concurrently
 func (r *TorrentRepo) Create(torrent *db.Torrent) (uint, error) {
 	queryResult := r.db.Create(torrent)
+	if errors.Is(queryResult.Error, gorm.ErrDuplicatedKey) {
+		return 0, engine.ErrTorrentAlreadyExists
+	}
 	if queryResult.Error != nil {
 		return 0, queryResult.Error
 	}
@@ -14,6 +14,37 @@ export interface Series {
   title: string;
   thumb: string;
   query: SeriesQueryServer | null;
+  metadata: SeriesMetadata | null;
+  seeding: SeedingPolicy | null;
+  archive: boolean;
+}
+
+export type SeedingMode = 'none' | 'ratio' | 'time' | 'converted'
+
+export interface SeedingPolicy {
+  mode: SeedingMode;
+  ratio: number;
+  minTimeSec: number;
+}
+
+export interface EpisodeTitle {
+  episode: string;
+  title: string;
+}
+
+export interface SeriesMetadata {
+  provider: string;
+  externalId: string;
+  title: string;
+  altTitles: string[];
+  synopsis: string;
+  year: number;
+  season: string;
+  genres: string[];
+  totalEpisodes: number;
+  poster: string;
+  episodes: EpisodeTitle[];
+  updatedAt: string;
 }
 
 export interface SeriesQueryServer {
@@ -31,16 +62,23 @@ export interface Progress {
   speed: number;
 }
 
-export type TorrentStatus = 'idle' | 'download' | 'analysis' | 'error' | 'ready'
+export type TorrentStatus = 'idle' | 'queued' | 'download' | 'analysis' | 'error' | 'ready' | 'cleaned'
 
 export interface Torrent {
   id: number;
   updatedAt: string;
   name: string;
   status: TorrentStatus;
+  priority: number;
+  downloadBpsLimit: number;
+  uploadBpsLimit: number;
   totalLength: number;
   totalDownloadLength: number;
   bytesRead: number;
+  bytesUploaded: number;
+  ratio: number;
+  seeding: boolean;
+  local: boolean;
   progress: Progress;
 }
 
@@ -55,11 +93,13 @@ export interface FileMetadata {
 
 export type FileType = 'video' | 'audio' | 'subtitle' | 'font' | 'archive' | 'unknown'
 
+export type TorrentFileStatus = 'idle' | 'download' | 'analysis' | 'error' | 'ready' | 'deleted'
+
 export interface TorrentFile {
   clientIndex: number;
   selected: boolean;
   path: string;
-  status: TorrentStatus;
+  status: TorrentFileStatus;
   length: number;
   type: FileType;
   suggestedMetadata: FileMetadata;
@@ -167,6 +207,77 @@ export interface WatcherStatePartial {
   status: string;
 }
 
+export type AdminEventType = 'torrent' | 'torrent-file' | 'conversion' | 'episode' | 'verification'
+
+export interface AdminEvent<T> {
+  type: AdminEventType;
+  message: T;
+}
+
+export interface TorrentEvent {
+  id: number;
+  status: TorrentStatus;
+  seeding: boolean;
+  progress: Progress;
+  bytesRead: number;
+  bytesUploaded: number;
+  deleted: boolean;
+}
+
+export interface TorrentFileEvent {
+  id: number;
+  torrentId: number;
+  status: TorrentFileStatus;
+  selected: boolean;
+  bytesCompleted: number;
+  length: number;
+}
+
+export interface ConversionEvent {
+  id: number;
+  status: ConversionStatus;
+  progress: Progress | null;
+  episodeId: number | null;
+  deleted: boolean;
+}
+
+export interface EpisodeEvent {
+  id: number;
+  seriesId: number | null;
+  title: string;
+  deleted: boolean;
+}
+
+export interface DirUsage {
+  name: string;
+  bytes: number;
+}
+
+export interface StorageUsage {
+  totalBytes: number;
+  freeBytes: number;
+  reservedBytes: number;
+  minFreeBytes: number;
+  dirs: DirUsage[];
+}
+
+export interface VerificationResult {
+  totalBytes: number;
+  validBytes: number;
+  validPercent: number;
+  complete: boolean;
+}
+
+export type VerificationStatus = 'running' | 'done' | 'error'
+
+export interface Verification {
+  torrentId: number;
+  status: VerificationStatus;
+  progress: number;
+  result: VerificationResult | null;
+  error: string;
+}
+
 export interface AutoTorrent {
   audioLang: string;
   subLang: string;
@@ -177,8 +288,14 @@ export interface SearchResult {
   title: string;
   provider: string;
   seeders: number;
-  size: string;
+  leechers: number;
+  completed: number;
+  size: number;
   date: string;
+  category: string;
+  trusted: boolean;
+  remake: boolean;
+  infoHash: string;
   link: string;
 }
 
@@ -195,3 +312,32 @@ export interface SetSeriesQueryRequest {
   query: SetSeriesQueryRequestData | null;
 }
 
+export type BackfillStatus = 'searching' | 'preview' | 'adding' | 'ready' | 'error';
+
+export interface BackfillItem {
+  id: string;
+  title: string;
+  link: string;
+  size: number;
+  date: string;
+  added: boolean;
+  error: string;
+}
+
+export interface Backfill {
+  id: number;
+  seriesId: number;
+  provider: string;
+  status: BackfillStatus;
+  progress: number;
+  error: string;
+  items: BackfillItem[] | null;
+}
+
+export interface StartBackfillRequest {
+  seriesID: number;
+  query: SetSeriesQueryRequestData;
+  maxPages?: number;
+  dedupeEpisodes: boolean;
+}
+
@@ -26,3 +26,11 @@ export async function deleteEpisode(id: number): Promise<void> {
     withCredentials: true,
   })
 }
+
+export async function deleteBackfill(id: number): Promise<void> {
+  await axios({
+    method: 'delete',
+    url: `${BASE_URL}/admin/search/backfill/${id}`,
+    withCredentials: true,
+  })
+}
@@ -1,5 +1,15 @@
 import axios from 'axios';
-import {Conversion, Episode, GetEpisodesResponse, Series, Torrent, TorrentWithFiles, User} from 'src/lib/api-types';
+import {
+  Backfill,
+  Conversion,
+  Episode,
+  GetEpisodesResponse,
+  Series,
+  Torrent,
+  TorrentWithFiles,
+  User,
+  Verification
+} from 'src/lib/api-types';
 
 axios.defaults.timeout = 10000;
 
@@ -138,3 +148,23 @@ export async function fetchConversionLogs(id: number): Promise<string> {
   );
   return data;
 }
+
+export async function fetchBackfill(id: number): Promise<Backfill> {
+  const {data}: { data: Backfill } = await axios.get(
+    `${BASE_URL}/admin/search/backfill/${id}`,
+    {
+      withCredentials: true,
+    }
+  );
+  return data;
+}
+
+export async function fetchVerification(torrentId: number): Promise<Verification> {
+  const {data}: { data: Verification } = await axios.get(
+    `${BASE_URL}/admin/torrent/${torrentId}/verify`,
+    {
+      withCredentials: true,
+    }
+  );
+  return data;
+}
@@ -1,5 +1,13 @@
 import axios, {AxiosProgressEvent} from 'axios';
-import {AutoTorrent, SearchResult, SetSeriesQueryRequestData, StartConversionRequest, User} from 'src/lib/api-types';
+import {
+  AutoTorrent,
+  SearchResult,
+  SetSeriesQueryRequestData,
+  StartBackfillRequest,
+  StartConversionRequest,
+  User,
+  Verification
+} from 'src/lib/api-types';
 
 const BASE_URL = import.meta.env.VITE_BASE_URL
 console.log(`BASE_URL = ${BASE_URL}`)
@@ -131,11 +139,12 @@ export async function postSearchTorrents(query: string, page?: number): Promise<
   return data;
 }
 
-export async function postNewTorrentFromSearch(seriesId: number, torrentId: string, provider: string, auto?: AutoTorrent): Promise<void> {
+export async function postNewTorrentFromSearch(seriesId: number, torrentId: string, provider: string, link: string, auto?: AutoTorrent): Promise<void> {
   await axios.post(`${BASE_URL}/admin/torrent/fromSearch`, {
     seriesId,
     torrentId,
     provider,
+    link,
     auto
   }, {
     withCredentials: true,
@@ -154,6 +163,23 @@ export async function postStartTorrent(torrentId: number, fileIndices: number[])
   });
 }
 
+export async function postUpdateTorrentSelection(torrentId: number, add: number[], remove: number[]): Promise<void> {
+  await axios.post(`${BASE_URL}/admin/torrent/selection`, {
+    id: torrentId,
+    add,
+    remove,
+  }, {
+    withCredentials: true,
+  });
+}
+
+export async function postVerifyTorrent(torrentId: number): Promise<Verification> {
+  const {data}: { data: Verification } = await axios.post(`${BASE_URL}/admin/torrent/${torrentId}/verify`, null, {
+    withCredentials: true,
+  });
+  return data;
+}
+
 export async function postStopTorrent(torrentId: number): Promise<void> {
   await axios.post(`${BASE_URL}/admin/torrent/stop`, {
     id: torrentId,
@@ -171,13 +197,18 @@ export async function postSetSeriesQuery(seriesId: number, query: SetSeriesQuery
   });
 }
 
-export async function postAddTorrentsFromQuery(seriesId: number, query: SetSeriesQueryRequestData): Promise<void> {
-  await axios.post(`${BASE_URL}/admin/torrent/fromQuery`, {
-    seriesId,
-    query
+export async function postStartBackfill(req: StartBackfillRequest): Promise<number> {
+  const {data}: { data: number } = await axios.post(`${BASE_URL}/admin/search/backfill`, req, {
+    withCredentials: true,
+  });
+  return data;
+}
+
+export async function postConfirmBackfill(backfillId: number, ids: string[]): Promise<void> {
+  await axios.post(`${BASE_URL}/admin/search/backfill/${backfillId}/confirm`, {
+    ids,
   }, {
     withCredentials: true,
-    timeout: 0,
   });
 }
 
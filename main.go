@@ -6,9 +6,13 @@ import (
 	"anileha/db/repo"
 	"anileha/ffmpeg/analyze"
 	"anileha/ffmpeg/command"
+	"anileha/metadata"
+	"anileha/metadata/anilist"
 	"anileha/rest/controller"
 	"anileha/rest/engine"
+	"anileha/search"
 	"anileha/search/nyaa"
+	"anileha/search/torznab"
 	"anileha/service"
 	"anileha/util/logger"
 	_ "go.uber.org/automaxprocs"
@@ -24,7 +28,6 @@ import (
 // TODO: MAKE ERRORS MORE INFORMATIVE :/
 // TODO: rate limit
 // TODO: improve logging
-// TODO: delete ready torrent directory
 
 func main() {
 	fx.New(
@@ -41,9 +44,16 @@ func main() {
 		repo.ConversionExport,
 		repo.EpisodeExport,
 		repo.LastRSSExport,
+		repo.PendingRSSExport,
 
 		// search
+		search.RegistryExport,
 		nyaa.Export,
+		torznab.Export,
+
+		// metadata
+		metadata.RegistryExport,
+		anilist.Export,
 
 		// services
 		service.FileExport,
@@ -56,7 +66,11 @@ func main() {
 		service.UserExport,
 		service.RoomExport,
 		service.SearchExport,
+		service.BackfillExport,
+		service.MetadataExport,
 		service.FontExport,
+		service.EventExport,
+		service.StorageExport,
 
 		// rest controllers
 		controller.HealthExport,
@@ -67,7 +81,9 @@ func main() {
 		controller.EpisodeExport,
 		controller.UserExport,
 		controller.SearchExport,
+		controller.MetadataExport,
 		controller.WebsocketExport,
+		controller.StorageExport,
 
 		// misc
 		analyze.ProbeAnalyzerExport,
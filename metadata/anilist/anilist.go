@@ -0,0 +1,307 @@
+package anilist
+
+import (
+	"anileha/config"
+	"anileha/metadata"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/elliotchance/pie/v2"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ProviderName = "anilist"
+
+const mediaFields = `
+	id
+	title { romaji english native }
+	synonyms
+	description(asHtml: false)
+	season
+	seasonYear
+	genres
+	episodes
+	coverImage { extraLarge large }
+	streamingEpisodes { title }
+`
+
+const searchQuery = `query ($search: String) {
+	Page(perPage: 10) {
+		media(search: $search, type: ANIME, sort: SEARCH_MATCH) {` + mediaFields + `}
+	}
+}`
+
+const mediaQuery = `query ($id: Int) {
+	Media(id: $id, type: ANIME) {` + mediaFields + `}
+}`
+
+var tagRegex = regexp.MustCompile("<[^>]*>")
+var newlinesRegex = regexp.MustCompile(`\n{3,}`)
+
+// episodeTitleRegex Streaming episode titles look like "Episode 3 - Title"
+var episodeTitleRegex = regexp.MustCompile(`^Episode\s+(\d+(?:\.\d+)?)\s*-\s*(.+)$`)
+
+type Service struct {
+	config      *config.Config
+	log         *zap.Logger
+	rateLimiter *rate.Limiter
+	client      *http.Client
+}
+
+var _ metadata.Provider = (*Service)(nil)
+
+type media struct {
+	ID    int `json:"id"`
+	Title struct {
+		Romaji  string `json:"romaji"`
+		English string `json:"english"`
+		Native  string `json:"native"`
+	} `json:"title"`
+	Synonyms    []string `json:"synonyms"`
+	Description string   `json:"description"`
+	Season      string   `json:"season"`
+	SeasonYear  int      `json:"seasonYear"`
+	Genres      []string `json:"genres"`
+	Episodes    int      `json:"episodes"`
+	CoverImage  struct {
+		ExtraLarge string `json:"extraLarge"`
+		Large      string `json:"large"`
+	} `json:"coverImage"`
+	StreamingEpisodes []struct {
+		Title string `json:"title"`
+	} `json:"streamingEpisodes"`
+}
+
+// title English title is preferred, since it is what most releases use
+func (m *media) title() string {
+	if m.Title.English != "" {
+		return m.Title.English
+	}
+	return m.Title.Romaji
+}
+
+func (m *media) altTitles() []string {
+	visited := map[string]struct{}{m.title(): {}}
+	titles := make([]string, 0, len(m.Synonyms)+3)
+
+	for _, alt := range append([]string{m.Title.Romaji, m.Title.English, m.Title.Native}, m.Synonyms...) {
+		if _, exists := visited[alt]; exists || alt == "" {
+			continue
+		}
+		visited[alt] = struct{}{}
+		titles = append(titles, alt)
+	}
+
+	return titles
+}
+
+func (m *media) poster() string {
+	if m.CoverImage.ExtraLarge != "" {
+		return m.CoverImage.ExtraLarge
+	}
+	return m.CoverImage.Large
+}
+
+// episodeTitles Streaming sites may list the same episode several times, the first title is used
+func (m *media) episodeTitles() []metadata.EpisodeTitle {
+	titles := make([]metadata.EpisodeTitle, 0, len(m.StreamingEpisodes))
+	visited := make(map[string]struct{}, len(m.StreamingEpisodes))
+
+	for _, episode := range m.StreamingEpisodes {
+		groups := episodeTitleRegex.FindStringSubmatch(strings.TrimSpace(episode.Title))
+		if groups == nil {
+			continue
+		}
+		if _, exists := visited[groups[1]]; exists {
+			continue
+		}
+		visited[groups[1]] = struct{}{}
+		titles = append(titles, metadata.EpisodeTitle{
+			Episode: groups[1],
+			Title:   strings.TrimSpace(groups[2]),
+		})
+	}
+
+	sort.SliceStable(titles, func(i, j int) bool {
+		first, _ := strconv.ParseFloat(titles[i].Episode, 64)
+		second, _ := strconv.ParseFloat(titles[j].Episode, 64)
+		return first < second
+	})
+
+	return titles
+}
+
+type graphqlRequest struct {
+	Query     string         `json:"query"`
+	Variables map[string]any `json:"variables"`
+}
+
+type graphqlResponse[T any] struct {
+	Data   T `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+		Status  int    `json:"status"`
+	} `json:"errors"`
+}
+
+func NewService(
+	config *config.Config,
+	log *zap.Logger,
+) (*Service, error) {
+	rlInterval := time.Duration(config.Metadata.RateLimit.IntervalMs) * time.Millisecond
+	rl := rate.NewLimiter(rate.Every(rlInterval), config.Metadata.RateLimit.Requests)
+
+	client := &http.Client{
+		Timeout: time.Duration(config.Metadata.TimeoutMs) * time.Millisecond,
+	}
+
+	return &Service{
+		config:      config,
+		log:         log,
+		rateLimiter: rl,
+		client:      client,
+	}, nil
+}
+
+func (s *Service) Name() string {
+	return ProviderName
+}
+
+func (s *Service) Search(ctx context.Context, title string) ([]metadata.SearchResult, error) {
+	var response graphqlResponse[struct {
+		Page struct {
+			Media []media `json:"media"`
+		} `json:"Page"`
+	}]
+
+	err := s.query(ctx, searchQuery, map[string]any{"search": title}, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return pie.Map(response.Data.Page.Media, func(m media) metadata.SearchResult {
+		return metadata.SearchResult{
+			ID:       strconv.Itoa(m.ID),
+			Title:    m.title(),
+			Year:     m.SeasonYear,
+			Season:   strings.ToLower(m.Season),
+			Episodes: m.Episodes,
+			Poster:   m.poster(),
+		}
+	}), nil
+}
+
+func (s *Service) GetById(ctx context.Context, id string) (metadata.Anime, error) {
+	mediaId, err := strconv.Atoi(id)
+	if err != nil {
+		return metadata.Anime{}, fmt.Errorf("%w: invalid anilist id %s", metadata.ErrNotFound, id)
+	}
+
+	var response graphqlResponse[struct {
+		Media *media `json:"Media"`
+	}]
+
+	err = s.query(ctx, mediaQuery, map[string]any{"id": mediaId}, &response)
+	if err != nil {
+		return metadata.Anime{}, err
+	}
+
+	m := response.Data.Media
+	if m == nil {
+		return metadata.Anime{}, metadata.ErrNotFound
+	}
+
+	return metadata.Anime{
+		ID:            strconv.Itoa(m.ID),
+		Title:         m.title(),
+		AltTitles:     m.altTitles(),
+		Synopsis:      cleanDescription(m.Description),
+		Year:          m.SeasonYear,
+		Season:        strings.ToLower(m.Season),
+		Genres:        m.Genres,
+		Episodes:      m.Episodes,
+		Poster:        m.poster(),
+		EpisodeTitles: m.episodeTitles(),
+	}, nil
+}
+
+// cleanDescription AniList descriptions may contain html tags and entities even if html is not requested
+func cleanDescription(description string) string {
+	description = strings.ReplaceAll(description, "<br>", "\n")
+	description = tagRegex.ReplaceAllString(description, "")
+	description = newlinesRegex.ReplaceAllString(description, "\n\n")
+	return strings.TrimSpace(html.UnescapeString(description))
+}
+
+// query Performs GraphQL request, missing media is reported by AniList as an error with 404 status
+func (s *Service) query(ctx context.Context, query string, variables map[string]any, response any) error {
+	body, err := json.Marshal(graphqlRequest{
+		Query:     query,
+		Variables: variables,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	if err := s.rateLimiter.Wait(ctx); err != nil {
+		return fmt.Errorf("request cancelled: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.config.Metadata.AniList.ApiUrl, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to do request: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBytes, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var errorResponse graphqlResponse[json.RawMessage]
+	if err := json.Unmarshal(resBytes, &errorResponse); err != nil {
+		s.log.Error("failed to parse anilist response",
+			zap.Int("code", res.StatusCode),
+			zap.String("body", string(resBytes)),
+			zap.Error(err))
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if len(errorResponse.Errors) > 0 {
+		first := errorResponse.Errors[0]
+		if first.Status == http.StatusNotFound {
+			return metadata.ErrNotFound
+		}
+		return fmt.Errorf("anilist error %d: %s", first.Status, first.Message)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("got invalid status code: %d", res.StatusCode)
+	}
+
+	if err := json.Unmarshal(resBytes, response); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return nil
+}
+
+var Export = fx.Options(fx.Provide(metadata.AsProvider(NewService)))
@@ -0,0 +1,118 @@
+package anilist
+
+import (
+	"anileha/config"
+	"anileha/metadata"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestService Stands in for AniList api, media with id 1 hits rate limit, other unknown ids are not found
+func newTestService(t *testing.T) *Service {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "POST", r.Method)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var req graphqlRequest
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+
+		fixture := "not_found.json"
+		status := http.StatusNotFound
+
+		if strings.Contains(req.Query, "Page(") {
+			assert.Equal(t, "blue lock", req.Variables["search"])
+			fixture, status = "search.json", http.StatusOK
+		} else if req.Variables["id"] == float64(137822) {
+			fixture, status = "media.json", http.StatusOK
+		} else if req.Variables["id"] == float64(1) {
+			fixture, status = "rate_limit.json", http.StatusTooManyRequests
+		}
+
+		data, err := os.ReadFile(filepath.Join("testdata", fixture))
+		require.Nil(t, err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := config.GetDefaultConfig()
+	cfg.Metadata.RateLimit.IntervalMs = 1
+	cfg.Metadata.AniList.ApiUrl = server.URL
+
+	service, err := NewService(&cfg, zap.NewNop())
+	require.Nil(t, err)
+
+	return service
+}
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+
+	results, err := service.Search(ctx, "blue lock")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(results))
+
+	assert.Equal(t, "137822", results[0].ID)
+	assert.Equal(t, "BLUELOCK", results[0].Title)
+	assert.Equal(t, 2022, results[0].Year)
+	assert.Equal(t, "fall", results[0].Season)
+	assert.Equal(t, 24, results[0].Episodes)
+
+	assert.Equal(t, "Blue Lock: Episode Nagi", results[1].Title)
+	assert.Equal(t, "https://s4.anilist.co/file/anilistcdn/media/anime/cover/medium/bx163146-8rJ8Rn1WDSzm.jpg", results[1].Poster)
+}
+
+func TestGetById(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+
+	anime, err := service.GetById(ctx, "137822")
+	require.Nil(t, err)
+
+	assert.Equal(t, "137822", anime.ID)
+	assert.Equal(t, "BLUELOCK", anime.Title)
+	assert.Equal(t, []string{"Blue Lock", "ブルーロック", "บลูล็อก ขังดวลแข้ง"}, anime.AltTitles)
+	assert.Equal(t, "After a disastrous defeat at the 2018 World Cup, Japan's team struggles to regroup.\n\n(Source: Crunchyroll)\n\nNote: Episode 14 & 15 were delayed.", anime.Synopsis)
+	assert.Equal(t, 2022, anime.Year)
+	assert.Equal(t, "fall", anime.Season)
+	assert.Equal(t, []string{"Action", "Drama", "Sports"}, anime.Genres)
+	assert.Equal(t, 24, anime.Episodes)
+	assert.Equal(t, "https://s4.anilist.co/file/anilistcdn/media/anime/cover/large/bx137822-4dVWMSHLpGf8.png", anime.Poster)
+	assert.Equal(t, []metadata.EpisodeTitle{
+		{Episode: "1", Title: "Dream"},
+		{Episode: "2", Title: "Soccer's Desire"},
+		{Episode: "10", Title: "Premonition and Intuition"},
+	}, anime.EpisodeTitles)
+}
+
+func TestGetByIdNotFound(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+
+	_, err := service.GetById(ctx, "404")
+	assert.ErrorIs(t, err, metadata.ErrNotFound)
+
+	_, err = service.GetById(ctx, "not a number")
+	assert.ErrorIs(t, err, metadata.ErrNotFound)
+}
+
+func TestGetByIdError(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+
+	_, err := service.GetById(ctx, "1")
+	require.NotNil(t, err)
+	assert.NotErrorIs(t, err, metadata.ErrNotFound)
+	assert.Contains(t, err.Error(), "Too Many Requests")
+}
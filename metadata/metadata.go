@@ -0,0 +1,44 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+)
+
+// Provider External anime catalog, ids are provider specific
+type Provider interface {
+	Name() string
+	// Search Returns anime with matching titles, best matches first
+	Search(ctx context.Context, title string) ([]SearchResult, error)
+	// GetById Returns full anime info, ErrNotFound if there is no anime with such id
+	GetById(ctx context.Context, id string) (Anime, error)
+}
+
+var ErrNotFound = errors.New("anime not found")
+
+type SearchResult struct {
+	ID       string
+	Title    string
+	Year     int
+	Season   string
+	Episodes int
+	Poster   string
+}
+
+type EpisodeTitle struct {
+	Episode string
+	Title   string
+}
+
+type Anime struct {
+	ID            string
+	Title         string
+	AltTitles     []string
+	Synopsis      string
+	Year          int
+	Season        string
+	Genres        []string
+	Episodes      int
+	Poster        string
+	EpisodeTitles []EpisodeTitle
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"anileha/metadata"
+	"anileha/rest/dao"
+	"anileha/rest/engine"
+	"anileha/service"
+	"github.com/elliotchance/pie/v2"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+func mapMetadataSearchResultsToResponseSlice(results []metadata.SearchResult,
+	provider string) []dao.MetadataSearchResultDao {
+	return pie.Map(results, func(r metadata.SearchResult) dao.MetadataSearchResultDao {
+		return dao.MetadataSearchResultDao{
+			ID:       r.ID,
+			Provider: provider,
+			Title:    r.Title,
+			Year:     r.Year,
+			Season:   r.Season,
+			Episodes: r.Episodes,
+			Poster:   r.Poster,
+		}
+	})
+}
+
+func registerMetadataController(
+	ginEngine *gin.Engine,
+	log *zap.Logger,
+	providerRegistry *metadata.Registry,
+	metadataService *service.MetadataService,
+) {
+	metadataGroup := ginEngine.Group("/admin/metadata")
+	metadataGroup.Use(engine.RoleMiddleware(log, []string{"admin"}))
+
+	metadataGroup.GET("/providers", func(c *gin.Context) {
+		c.JSON(http.StatusOK, providerRegistry.Names())
+	})
+
+	metadataGroup.POST("/search", func(c *gin.Context) {
+		var req dao.MetadataSearchRequestDao
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Error(engine.ErrBadRequest(err.Error()))
+			return
+		}
+
+		provider, err := providerRegistry.Get(req.Provider)
+		if err != nil {
+			c.Error(engine.ErrBadRequest(err.Error()))
+			return
+		}
+
+		results, err := provider.Search(c.Request.Context(), req.Query)
+		if err != nil {
+			c.Error(engine.ErrInternal(err.Error()))
+			return
+		}
+
+		c.JSON(http.StatusOK, mapMetadataSearchResultsToResponseSlice(results, provider.Name()))
+	})
+
+	metadataGroup.POST("/series/link", func(c *gin.Context) {
+		var req dao.LinkMetadataRequestDao
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Error(engine.ErrBadRequest(err.Error()))
+			return
+		}
+
+		seriesMetadata, err := metadataService.Link(c.Request.Context(), req.SeriesID, req.Provider, req.ExternalID)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(http.StatusOK, seriesMetadata)
+	})
+
+	metadataGroup.POST("/series/refresh", func(c *gin.Context) {
+		var req dao.RefreshMetadataRequestDao
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Error(engine.ErrBadRequest(err.Error()))
+			return
+		}
+
+		seriesMetadata, err := metadataService.Refresh(c.Request.Context(), req.SeriesID)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(http.StatusOK, seriesMetadata)
+	})
+}
+
+var MetadataExport = fx.Options(fx.Invoke(registerMetadataController))
@@ -18,6 +18,7 @@ func registerWebsocketController(
 	ginEngine *gin.Engine,
 	userService *service.UserService,
 	roomService *service.RoomService,
+	eventService *service.EventService,
 ) {
 	bufferSize := config.WebSocket.BufferSize
 
@@ -59,6 +60,26 @@ func registerWebsocketController(
 
 		roomService.HandleConnection(ws, user, roomIdString)
 	})
+
+	eventsGroup := ginEngine.Group("/admin/events")
+	eventsGroup.Use(engine.RoleMiddleware(log, []string{"admin"}))
+
+	eventsGroup.GET("/ws", func(c *gin.Context) {
+		authUser := c.MustGet(engine.UserKey).(*db.AuthUser)
+		user, err := userService.GetById(authUser.ID)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			c.Error(engine.ErrInternal("failed to upgrade connection to websocket"))
+			return
+		}
+
+		eventService.HandleConnection(ws, user)
+	})
 }
 
 var WebsocketExport = fx.Options(fx.Invoke(registerWebsocketController))
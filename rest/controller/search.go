@@ -6,25 +6,31 @@ import (
 	"anileha/rest/dao"
 	"anileha/rest/engine"
 	"anileha/search"
-	"anileha/search/nyaa"
 	"anileha/service"
 	"github.com/elliotchance/pie/v2"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
 func mapResultToResponse(r search.Result, provider string) dao.SearchResultDao {
 	return dao.SearchResultDao{
-		ID:       r.ID,
-		Title:    r.Title,
-		Provider: provider,
-		Seeders:  r.Seeders,
-		Size:     r.Size,
-		Date:     r.Date,
-		Link:     r.Link,
+		ID:        r.ID,
+		Title:     r.Title,
+		Provider:  provider,
+		Seeders:   r.Seeders,
+		Leechers:  r.Leechers,
+		Completed: r.Completed,
+		Size:      r.Size,
+		Date:      r.Date,
+		Category:  r.Category,
+		Trusted:   r.Trusted,
+		Remake:    r.Remake,
+		InfoHash:  r.InfoHash,
+		Link:      r.Link,
 	}
 }
 
@@ -36,34 +42,130 @@ func mapResultsToResponseSlice(results []search.Result, provider string) []dao.S
 	return res
 }
 
+func mapQueryTestCandidatesToResponseSlice(candidates []service.QueryTestCandidate) []dao.QueryTestCandidateDao {
+	return pie.Map(candidates, func(candidate service.QueryTestCandidate) dao.QueryTestCandidateDao {
+		return dao.QueryTestCandidateDao{
+			Source:   candidate.Source,
+			ID:       candidate.ID,
+			Title:    candidate.Title,
+			Link:     candidate.Link,
+			Provider: candidate.Provider,
+			Matched:  candidate.Reason == service.RejectNone,
+			Reason:   string(candidate.Reason),
+			Metadata: candidate.Metadata,
+			Release:  candidate.Release,
+		}
+	})
+}
+
+func mapBackfillToResponse(job service.BackfillJob) dao.BackfillResponseDao {
+	return dao.BackfillResponseDao{
+		ID:       job.ID,
+		SeriesId: job.SeriesId,
+		Provider: job.Provider,
+		Status:   string(job.Status),
+		Progress: job.Progress,
+		Error:    job.Error,
+		Items: pie.Map(job.Items, func(item service.BackfillItem) dao.BackfillItemDao {
+			return dao.BackfillItemDao{
+				ID:      item.ID,
+				Title:   item.Title,
+				Link:    item.Link,
+				Size:    item.Size,
+				Date:    item.Date,
+				Release: item.Release,
+				Added:   item.Added,
+				Error:   item.Error,
+			}
+		}),
+	}
+}
+
+var searchSortTypes = map[string]search.Sort{
+	"":          search.SortSeeders,
+	"date":      search.SortDate,
+	"seeders":   search.SortSeeders,
+	"size":      search.SortSize,
+	"leechers":  search.SortLeechers,
+	"completed": search.SortCompleted,
+}
+
+func splitQueryWords(str string) []string {
+	return pie.Map(pie.Filter(strings.Fields(strings.TrimSpace(str)), func(s string) bool {
+		return len(s) > 0
+	}), func(value string) string {
+		return strings.ToLower(value)
+	})
+}
+
+func mapSeriesQueryRequest(req dao.SeriesQueryRequestDataDao) db.SeriesQuery {
+	return db.SeriesQuery{
+		Include:      splitQueryWords(req.Include),
+		Exclude:      splitQueryWords(req.Exclude),
+		IncludeRegex: strings.TrimSpace(req.IncludeRegex),
+		ExcludeRegex: strings.TrimSpace(req.ExcludeRegex),
+		MinEpisode:   req.MinEpisode,
+		MaxEpisode:   req.MaxEpisode,
+		Scoring:      req.Scoring,
+		Provider:     strings.TrimSpace(req.Provider),
+		SingleFile:   req.SingleFile,
+		TrustedOnly:  req.TrustedOnly,
+		MinSeeders:   req.MinSeeders,
+		FeedUrl:      strings.TrimSpace(req.FeedUrl),
+		FeedParams:   req.FeedParams,
+		Category:     strings.TrimSpace(req.Category),
+		SiteFilter:   req.SiteFilter,
+		Auto:         req.Auto,
+	}
+}
+
 func registerSearchController(
 	ginEngine *gin.Engine,
 	log *zap.Logger,
 	config *config.Config,
-	nyaaService *nyaa.Service,
+	providerRegistry *search.Registry,
 	seriesService *service.SeriesService,
 	searchService *service.SearchService,
+	backfillService *service.BackfillService,
 ) {
 	searchGroup := ginEngine.Group("/admin/search")
 	searchGroup.Use(engine.RoleMiddleware(log, []string{"admin"}))
 	searchGroup.POST("/torrent", func(c *gin.Context) {
-		var req dao.QueryRequestDao
+		var req dao.SearchRequestDao
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.Error(engine.ErrBadRequest(err.Error()))
 			return
 		}
 
-		res, err := nyaaService.Search(c.Request.Context(), search.Query{
+		provider, err := providerRegistry.Get(req.Provider)
+		if err != nil {
+			c.Error(engine.ErrBadRequest(err.Error()))
+			return
+		}
+
+		res, err := provider.Search(c.Request.Context(), search.Query{
 			Query:    req.Query,
 			Page:     req.Page,
-			SortType: search.SortSeeders,
+			SortType: searchSortTypes[req.Sort],
+			Category: strings.TrimSpace(req.Category),
+			Filter:   search.SiteFilter(req.SiteFilter),
 		})
 		if err != nil {
 			c.Error(engine.ErrBadRequest(err.Error()))
 			return
 		}
 
-		c.JSON(http.StatusOK, mapResultsToResponseSlice(res, "nyaa"))
+		filter := search.Filter{
+			MinSeeders: req.MinSeeders,
+			MaxSize:    req.MaxSize,
+		}
+		res = pie.Filter(res, filter.Test)
+
+		c.JSON(http.StatusOK, mapResultsToResponseSlice(res, provider.Name()))
+	})
+
+	searchGroup.GET("/providers", func(c *gin.Context) {
+		c.JSON(http.StatusOK, providerRegistry.Names())
 	})
 
 	searchGroup.POST("/series/setQuery", func(c *gin.Context) {
@@ -76,25 +178,8 @@ func registerSearchController(
 		var err error
 
 		if req.Query != nil {
-			include := pie.Map(pie.Filter(strings.Fields(strings.TrimSpace(req.Query.Include)), func(s string) bool {
-				return len(s) > 0
-			}), func(value string) string {
-				return strings.ToLower(value)
-			})
-
-			exclude := pie.Map(pie.Filter(strings.Fields(strings.TrimSpace(req.Query.Exclude)), func(s string) bool {
-				return len(s) > 0
-			}), func(value string) string {
-				return strings.ToLower(value)
-			})
-
-			err = seriesService.SetQuery(req.SeriesID, &db.SeriesQuery{
-				Include:    include,
-				Exclude:    exclude,
-				Provider:   strings.TrimSpace(req.Query.Provider),
-				SingleFile: req.Query.SingleFile,
-				Auto:       req.Query.Auto,
-			})
+			query := mapSeriesQueryRequest(*req.Query)
+			err = seriesService.SetQuery(req.SeriesID, &query)
 		} else {
 			err = seriesService.SetQuery(req.SeriesID, nil)
 		}
@@ -105,6 +190,100 @@ func registerSearchController(
 
 		c.JSON(http.StatusOK, "OK")
 	})
+
+	searchGroup.POST("/series/testQuery", func(c *gin.Context) {
+		var req dao.SeriesQueryRequestDataDao
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Error(engine.ErrBadRequest(err.Error()))
+			return
+		}
+
+		candidates, err := searchService.TestQuery(c.Request.Context(), mapSeriesQueryRequest(req))
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(http.StatusOK, mapQueryTestCandidatesToResponseSlice(candidates))
+	})
+
+	searchGroup.POST("/backfill", func(c *gin.Context) {
+		var req dao.StartBackfillRequestDao
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Error(engine.ErrBadRequest(err.Error()))
+			return
+		}
+
+		id, err := backfillService.Start(service.BackfillParams{
+			SeriesId:       req.SeriesID,
+			Query:          mapSeriesQueryRequest(req.Query),
+			MaxPages:       req.MaxPages,
+			Since:          req.Since,
+			MaxSize:        req.MaxSize,
+			DedupeEpisodes: req.DedupeEpisodes,
+		})
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(http.StatusOK, id)
+	})
+
+	searchGroup.GET("/backfill/:id", func(c *gin.Context) {
+		idString := c.Param("id")
+		id, err := strconv.ParseUint(idString, 10, 64)
+		if err != nil {
+			c.Error(engine.ErrBadRequest("failed to parse id"))
+			return
+		}
+
+		job, err := backfillService.Get(uint(id))
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(http.StatusOK, mapBackfillToResponse(job))
+	})
+
+	searchGroup.POST("/backfill/:id/confirm", func(c *gin.Context) {
+		idString := c.Param("id")
+		id, err := strconv.ParseUint(idString, 10, 64)
+		if err != nil {
+			c.Error(engine.ErrBadRequest("failed to parse id"))
+			return
+		}
+
+		var req dao.ConfirmBackfillRequestDao
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Error(engine.ErrBadRequest(err.Error()))
+			return
+		}
+
+		if err := backfillService.Confirm(uint(id), req.IDs); err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(http.StatusOK, "OK")
+	})
+
+	searchGroup.DELETE("/backfill/:id", func(c *gin.Context) {
+		idString := c.Param("id")
+		id, err := strconv.ParseUint(idString, 10, 64)
+		if err != nil {
+			c.Error(engine.ErrBadRequest("failed to parse id"))
+			return
+		}
+
+		if err := backfillService.Cancel(uint(id)); err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(http.StatusOK, "OK")
+	})
 }
 
 var SearchExport = fx.Options(fx.Invoke(registerSearchController))
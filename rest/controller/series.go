@@ -22,12 +22,29 @@ func mapSeriesToResponse(series db.Series) dao.SeriesResponseDao {
 		queryValue = &actualValue
 	}
 
+	var metadataValue *db.SeriesMetadata
+
+	if series.Metadata != nil {
+		actualValue := series.Metadata.Data()
+		metadataValue = &actualValue
+	}
+
+	var seedingValue *db.SeedingPolicy
+
+	if series.Seeding != nil {
+		actualValue := series.Seeding.Data()
+		seedingValue = &actualValue
+	}
+
 	return dao.SeriesResponseDao{
 		ID:         series.ID,
 		Title:      series.Title,
 		LastUpdate: series.LastUpdate,
 		Thumb:      series.Thumb.Url,
 		Query:      queryValue,
+		Metadata:   metadataValue,
+		Seeding:    seedingValue,
+		Archive:    series.Archive,
 	}
 }
 
@@ -127,6 +144,47 @@ func registerSeriesController(
 		c.String(http.StatusOK, "OK")
 	})
 
+	adminSeriesGroup.POST("/seeding", func(c *gin.Context) {
+		var req dao.SeriesSeedingRequestDao
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Error(engine.ErrBadRequest(err.Error()))
+			return
+		}
+
+		var err error
+
+		if req.Policy != nil {
+			err = seriesService.SetSeedingPolicy(req.SeriesID, &db.SeedingPolicy{
+				Mode:       req.Policy.Mode,
+				Ratio:      req.Policy.Ratio,
+				MinTimeSec: req.Policy.MinTimeSec,
+			})
+		} else {
+			err = seriesService.SetSeedingPolicy(req.SeriesID, nil)
+		}
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(http.StatusOK, "OK")
+	})
+
+	adminSeriesGroup.POST("/archive", func(c *gin.Context) {
+		var req dao.SeriesArchiveRequestDao
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Error(engine.ErrBadRequest(err.Error()))
+			return
+		}
+
+		if err := seriesService.SetArchive(req.SeriesID, req.Archive); err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(http.StatusOK, "OK")
+	})
+
 	adminSeriesGroup.POST("/", func(c *gin.Context) {
 		title, titleExists := c.GetPostForm("title")
 		if !titleExists {
@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"anileha/rest/engine"
+	"anileha/service"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+func registerStorageController(
+	log *zap.Logger,
+	ginEngine *gin.Engine,
+	storageService *service.StorageService,
+) {
+	storageGroup := ginEngine.Group("/admin/storage")
+	storageGroup.Use(engine.RoleMiddleware(log, []string{"admin"}))
+
+	storageGroup.GET("", func(c *gin.Context) {
+		usage, err := storageService.GetUsage()
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, usage)
+	})
+}
+
+var StorageExport = fx.Options(fx.Invoke(registerStorageController))
@@ -5,10 +5,10 @@ import (
 	"anileha/db"
 	"anileha/rest/dao"
 	"anileha/rest/engine"
-	"anileha/search/nyaa"
+	"anileha/search"
 	"anileha/service"
 	"encoding/json"
-	"github.com/elliotchance/pie/v2"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
@@ -16,6 +16,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func mapTorrentFilesToResponse(torrentFiles []db.TorrentFile) []dao.TorrentFileResponseDao {
@@ -40,11 +41,18 @@ func mapTorrentToResponse(torrent db.Torrent) dao.TorrentResponseDao {
 		ID:                  torrent.ID,
 		Name:                torrent.Name,
 		Status:              torrent.Status,
+		Priority:            torrent.Priority,
+		DownloadBpsLimit:    torrent.DownloadBpsLimit,
+		UploadBpsLimit:      torrent.UploadBpsLimit,
 		Source:              torrent.Source,
 		TotalLength:         torrent.TotalLength,
 		TotalDownloadLength: torrent.TotalDownloadLength,
 		Progress:            torrent.Progress,
 		BytesRead:           torrent.BytesRead,
+		BytesUploaded:       torrent.BytesUploaded,
+		Ratio:               torrent.Ratio(),
+		Seeding:             torrent.Seeding,
+		Local:               torrent.Local,
 		Files:               mapTorrentFilesToResponse(torrent.Files),
 		UpdatedAt:           torrent.UpdatedAt,
 	}
@@ -55,11 +63,18 @@ func mapTorrentWithoutFilesToResponse(torrent db.Torrent) dao.TorrentResponseWit
 		ID:                  torrent.ID,
 		Name:                torrent.Name,
 		Status:              torrent.Status,
+		Priority:            torrent.Priority,
+		DownloadBpsLimit:    torrent.DownloadBpsLimit,
+		UploadBpsLimit:      torrent.UploadBpsLimit,
 		Source:              torrent.Source,
 		TotalLength:         torrent.TotalLength,
 		TotalDownloadLength: torrent.TotalDownloadLength,
 		Progress:            torrent.Progress,
 		BytesRead:           torrent.BytesRead,
+		BytesUploaded:       torrent.BytesUploaded,
+		Ratio:               torrent.Ratio(),
+		Seeding:             torrent.Seeding,
+		Local:               torrent.Local,
 		UpdatedAt:           torrent.UpdatedAt,
 	}
 }
@@ -72,15 +87,28 @@ func mapTorrentsWithoutFilesToResponseSlice(torrents []db.Torrent) []dao.Torrent
 	return res
 }
 
+// respondAddedTorrent Duplicates are reported along with id of the existing torrent
+func respondAddedTorrent(c *gin.Context, id uint, err error) {
+	if errors.Is(err, engine.ErrTorrentAlreadyExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "id": id})
+		return
+	}
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, id)
+}
+
 func registerTorrentController(
 	log *zap.Logger,
 	config *config.Config,
 	ginEngine *gin.Engine,
 	fileService *service.FileService,
-	nyaaService *nyaa.Service,
-	searchService *service.SearchService,
+	providerRegistry *search.Registry,
 	torrentService *service.TorrentService,
 	convertService *service.ConversionService,
+	seriesService *service.SeriesService,
 ) {
 	torrentGroup := ginEngine.Group("/admin/torrent")
 	torrentGroup.Use(engine.RoleMiddleware(log, []string{"admin"}))
@@ -107,6 +135,122 @@ func registerTorrentController(
 		}
 		c.JSON(http.StatusOK, mapTorrentToResponse(*torrent))
 	})
+	torrentGroup.GET("queue", func(c *gin.Context) {
+		torrents, err := torrentService.GetQueue()
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, mapTorrentsWithoutFilesToResponseSlice(torrents))
+	})
+	torrentGroup.POST("queue/move", func(c *gin.Context) {
+		var req dao.MoveInQueueRequestDao
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Error(engine.ErrBadRequest(err.Error()))
+			return
+		}
+		if err := torrentService.MoveInQueue(req.Id, req.Position); err != nil {
+			c.Error(err)
+			return
+		}
+		c.String(http.StatusOK, "OK")
+	})
+	torrentGroup.POST("priority", func(c *gin.Context) {
+		var req dao.TorrentPriorityRequestDao
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Error(engine.ErrBadRequest(err.Error()))
+			return
+		}
+		if err := torrentService.SetPriority(req.Id, req.Priority); err != nil {
+			c.Error(err)
+			return
+		}
+		c.String(http.StatusOK, "OK")
+	})
+	torrentGroup.GET("bandwidth", func(c *gin.Context) {
+		c.JSON(http.StatusOK, torrentService.GetBandwidth())
+	})
+	torrentGroup.POST("bandwidth", func(c *gin.Context) {
+		var req dao.BandwidthOverrideRequestDao
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Error(engine.ErrBadRequest(err.Error()))
+			return
+		}
+		var limits *service.BandwidthLimits
+		if req.Limits != nil {
+			limits = &service.BandwidthLimits{
+				DownloadBps: req.Limits.DownloadBps,
+				UploadBps:   req.Limits.UploadBps,
+			}
+		}
+		c.JSON(http.StatusOK, torrentService.SetBandwidthOverride(limits))
+	})
+	torrentGroup.POST("bandwidth/torrent", func(c *gin.Context) {
+		var req dao.TorrentBandwidthRequestDao
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Error(engine.ErrBadRequest(err.Error()))
+			return
+		}
+		err := torrentService.SetTorrentBandwidth(req.Id, service.BandwidthLimits{
+			DownloadBps: req.DownloadBps,
+			UploadBps:   req.UploadBps,
+		})
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.String(http.StatusOK, "OK")
+	})
+	torrentGroup.GET(":id/stream/:fileIndex", func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.Error(engine.ErrBadRequest(err.Error()))
+			return
+		}
+		fileIndex, err := strconv.Atoi(c.Param("fileIndex"))
+		if err != nil {
+			c.Error(engine.ErrBadRequest(err.Error()))
+			return
+		}
+		stream, err := torrentService.OpenStream(c.Request.Context(), uint(id), fileIndex)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		if stream.Reader == nil {
+			c.File(stream.Path)
+			return
+		}
+		defer stream.Reader.Close()
+		// range requests are handled by ServeContent, reads block until requested pieces are downloaded
+		http.ServeContent(c.Writer, c.Request, stream.Name, time.Time{}, stream.Reader)
+	})
+	torrentGroup.POST(":id/verify", func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.Error(engine.ErrBadRequest(err.Error()))
+			return
+		}
+		verification, err := torrentService.Verify(uint(id))
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusAccepted, verification)
+	})
+	torrentGroup.GET(":id/verify", func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.Error(engine.ErrBadRequest(err.Error()))
+			return
+		}
+		verification, err := torrentService.GetVerification(uint(id))
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, verification)
+	})
 	torrentGroup.GET("series/:id", func(c *gin.Context) {
 		seriesIdString := c.Param("id")
 		id, err := strconv.ParseUint(seriesIdString, 10, 64)
@@ -144,6 +288,18 @@ func registerTorrentController(
 		}
 		c.String(http.StatusOK, "OK")
 	})
+	torrentGroup.POST("selection", func(c *gin.Context) {
+		var req dao.TorrentSelectionRequestDao
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.Error(engine.ErrBadRequest(err.Error()))
+			return
+		}
+		if err := torrentService.UpdateSelection(req.Id, req.Add, req.Remove); err != nil {
+			c.Error(err)
+			return
+		}
+		c.String(http.StatusOK, "OK")
+	})
 	torrentGroup.POST("stop", func(c *gin.Context) {
 		var req dao.IdRequestDao
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -155,7 +311,7 @@ func registerTorrentController(
 			c.Error(err)
 			return
 		}
-		if torrent.Status != db.TorrentDownload {
+		if torrent.Status != db.TorrentDownload && torrent.Status != db.TorrentQueued && !torrent.Seeding {
 			c.String(http.StatusOK, "Already stopped")
 			return
 		}
@@ -236,12 +392,8 @@ func registerTorrentController(
 			c.Error(engine.ErrInternal(err.Error()))
 			return
 		}
-		err = torrentService.AddFromFile(uint(seriesId), tempDst, auto)
-		if err != nil {
-			c.Error(err)
-			return
-		}
-		c.String(http.StatusOK, "OK")
+		id, err := torrentService.AddFromFile(uint(seriesId), tempDst, auto, nil, nil)
+		respondAddedTorrent(c, id, err)
 	})
 
 	torrentGroup.POST("/fromSearch", func(c *gin.Context) {
@@ -251,6 +403,12 @@ func registerTorrentController(
 			return
 		}
 
+		provider, err := providerRegistry.Get(req.Provider)
+		if err != nil {
+			c.Error(engine.ErrBadRequest(err.Error()))
+			return
+		}
+
 		tempDst, err := fileService.GenTempFilePath("new.torrent")
 		if err != nil {
 			c.Error(engine.ErrInternal(err.Error()))
@@ -258,7 +416,7 @@ func registerTorrentController(
 		}
 		defer fileService.DeleteTempFileAsync(tempDst)
 
-		bytes, err := nyaaService.DownloadById(c.Request.Context(), req.TorrentID)
+		bytes, err := provider.DownloadById(c.Request.Context(), req.TorrentID)
 		if err != nil {
 			c.Error(engine.ErrInternal(err.Error()))
 			return
@@ -270,80 +428,36 @@ func registerTorrentController(
 			return
 		}
 
-		err = torrentService.AddFromFile(req.SeriesID, tempDst, req.Auto)
-		if err != nil {
-			c.Error(err)
-			return
+		// source lets rss matcher skip releases that were added manually
+		var source *string
+		if req.Link != "" {
+			source = &req.Link
 		}
 
-		c.String(http.StatusOK, "OK")
+		id, err := torrentService.AddFromFile(req.SeriesID, tempDst, req.Auto, nil, source)
+		respondAddedTorrent(c, id, err)
 	})
 
-	torrentGroup.POST("/fromQuery", func(c *gin.Context) {
-		var req dao.AddTorrentQueryRequestDao
+	torrentGroup.POST("/fromMagnet", func(c *gin.Context) {
+		var req dao.AddTorrentFromMagnetRequestDao
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.Error(engine.ErrBadRequest(err.Error()))
 			return
 		}
 
-		var err error
-
-		include := pie.Map(pie.Filter(strings.Fields(strings.TrimSpace(req.Query.Include)), func(s string) bool {
-			return len(s) > 0
-		}), func(value string) string {
-			return strings.ToLower(value)
-		})
-
-		exclude := pie.Map(pie.Filter(strings.Fields(strings.TrimSpace(req.Query.Exclude)), func(s string) bool {
-			return len(s) > 0
-		}), func(value string) string {
-			return strings.ToLower(value)
-		})
-
-		results, err := searchService.SearchOld(c.Request.Context(), db.SeriesQuery{
-			Include:    include,
-			Exclude:    exclude,
-			Provider:   req.Query.Provider,
-			SingleFile: req.Query.SingleFile,
-			Auto:       req.Query.Auto,
-		})
-		if err != nil {
-			c.Error(err)
+		if req.Auto != nil && (req.Auto.AudioLang == "" || req.Auto.SubLang == "") {
+			c.Error(engine.ErrBadRequest("invalid auto JSON"))
 			return
 		}
 
-		reversed := pie.Reverse(results)
-
-		for _, res := range reversed {
-			tempDst, err := fileService.GenTempFilePath("new.torrent")
-			if err != nil {
-				c.Error(engine.ErrInternal(err.Error()))
-				return
-			}
-			defer fileService.DeleteTempFileAsync(tempDst)
-
-			bytes, err := nyaaService.DownloadById(c.Request.Context(), res.ID)
-			if err != nil {
-				c.Error(engine.ErrInternal(err.Error()))
-				return
-			}
-
-			err = os.WriteFile(tempDst, bytes, 0644)
-			if err != nil {
-				c.Error(engine.ErrInternal(err.Error()))
-				return
-			}
-
-			err = torrentService.AddFromFile(req.SeriesID, tempDst, &req.Query.Auto)
-			if err != nil {
-				c.Error(err)
-				return
-			}
-
-			c.String(http.StatusOK, "OK")
+		// resolving metadata takes a while, so series is checked beforehand
+		if _, err := seriesService.GetById(req.SeriesID); err != nil {
+			c.Error(err)
+			return
 		}
 
-		c.JSON(http.StatusOK, "OK")
+		id, err := torrentService.AddFromMagnet(c.Request.Context(), req.SeriesID, strings.TrimSpace(req.Magnet), req.Auto)
+		respondAddedTorrent(c, id, err)
 	})
 }
 
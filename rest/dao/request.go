@@ -1,24 +1,77 @@
 package dao
 
-import "anileha/db"
+import (
+	"anileha/db"
+	"time"
+)
 
 type QueryRequestDao struct {
 	Query string `json:"query" binding:"required"`
 	Page  int    `json:"page" binding:"gte=0"`
 }
 
+// SearchRequestDao SiteFilter is applied by the provider, MinSeeders and MaxSize filter loaded results
+type SearchRequestDao struct {
+	Query      string `json:"query" binding:"required"`
+	Page       int    `json:"page" binding:"gte=0"`
+	Provider   string `json:"provider"`
+	Sort       string `json:"sort" binding:"omitempty,oneof=date seeders size leechers completed"`
+	MinSeeders int    `json:"minSeeders" binding:"gte=0"`
+	MaxSize    uint64 `json:"maxSize"`
+	Category   string `json:"category"`
+	SiteFilter string `json:"siteFilter" binding:"omitempty,oneof=none noRemakes trustedOnly"`
+}
+
 type AddTorrentFromSearchRequestDao struct {
 	SeriesID  uint            `json:"seriesId" binding:"required"`
 	TorrentID string          `json:"torrentId" binding:"required"`
 	Provider  string          `json:"provider" binding:"required"`
+	Link      string          `json:"link" binding:"omitempty,url"` // Link view link of the search result, stored as torrent source
 	Auto      *db.AutoTorrent `json:"auto"`
 }
 
+type AddTorrentFromMagnetRequestDao struct {
+	SeriesID uint            `json:"seriesId" binding:"required"`
+	Magnet   string          `json:"magnet" binding:"required"`
+	Auto     *db.AutoTorrent `json:"auto"`
+}
+
 type StartTorrentRequestDao struct {
 	Id          uint  `json:"id" binding:"required"`
 	FileIndices []int `json:"fileIndices"`
 }
 
+type TorrentSelectionRequestDao struct {
+	Id     uint  `json:"id" binding:"required"`
+	Add    []int `json:"add"`
+	Remove []int `json:"remove"`
+}
+
+type TorrentPriorityRequestDao struct {
+	Id       uint `json:"id" binding:"required"`
+	Priority int  `json:"priority"`
+}
+
+type MoveInQueueRequestDao struct {
+	Id       uint `json:"id" binding:"required"`
+	Position int  `json:"position" binding:"gte=0"`
+}
+
+type BandwidthLimitsRequestDao struct {
+	DownloadBps int `json:"downloadBps" binding:"gte=0"`
+	UploadBps   int `json:"uploadBps" binding:"gte=0"`
+}
+
+type BandwidthOverrideRequestDao struct {
+	Limits *BandwidthLimitsRequestDao `json:"limits"`
+}
+
+type TorrentBandwidthRequestDao struct {
+	Id          uint `json:"id" binding:"required"`
+	DownloadBps int  `json:"downloadBps" binding:"gte=0"`
+	UploadBps   int  `json:"uploadBps" binding:"gte=0"`
+}
+
 type StartConversionFileChanPrefData struct {
 	Disable bool   `json:"disable"`
 	Stream  *int   `json:"stream"`
@@ -79,11 +132,22 @@ type AuthRequestDao struct {
 }
 
 type SeriesQueryRequestDataDao struct {
-	Provider   string         `json:"provider" binding:"required"`
-	Auto       db.AutoTorrent `json:"auto" binding:"required"`
-	Include    string         `json:"include" binding:"required"`
-	Exclude    string         `json:"exclude"`
-	SingleFile bool           `json:"singleFile"`
+	Provider     string             `json:"provider" binding:"required"`
+	Auto         db.AutoTorrent     `json:"auto" binding:"required"`
+	Include      string             `json:"include" binding:"required"`
+	Exclude      string             `json:"exclude"`
+	IncludeRegex string             `json:"includeRegex"`
+	ExcludeRegex string             `json:"excludeRegex"`
+	MinEpisode   *float64           `json:"minEpisode"`
+	MaxEpisode   *float64           `json:"maxEpisode"`
+	Scoring      *db.ReleaseScoring `json:"scoring"`
+	SingleFile   bool               `json:"singleFile"`
+	TrustedOnly  bool               `json:"trustedOnly"`
+	MinSeeders   int                `json:"minSeeders" binding:"gte=0"`
+	FeedUrl      string             `json:"feedUrl"`
+	FeedParams   map[string]string  `json:"feedParams"`
+	Category     string             `json:"category"`
+	SiteFilter   string             `json:"siteFilter" binding:"omitempty,oneof=none noRemakes trustedOnly"`
 }
 
 type SeriesQueryRequestDao struct {
@@ -91,7 +155,46 @@ type SeriesQueryRequestDao struct {
 	Query    *SeriesQueryRequestDataDao `json:"query"`
 }
 
-type AddTorrentQueryRequestDao struct {
-	SeriesID uint                      `json:"seriesID" binding:"required"`
-	Query    SeriesQueryRequestDataDao `json:"query" binding:"required"`
+type SeedingPolicyRequestDao struct {
+	Mode       db.SeedingMode `json:"mode" binding:"required,oneof=none ratio time converted"`
+	Ratio      float64        `json:"ratio" binding:"gte=0"`
+	MinTimeSec int            `json:"minTimeSec" binding:"gte=0"`
+}
+
+type SeriesSeedingRequestDao struct {
+	SeriesID uint                     `json:"seriesID" binding:"required"`
+	Policy   *SeedingPolicyRequestDao `json:"policy"`
+}
+
+type SeriesArchiveRequestDao struct {
+	SeriesID uint `json:"seriesID" binding:"required"`
+	Archive  bool `json:"archive"`
+}
+
+type StartBackfillRequestDao struct {
+	SeriesID       uint                      `json:"seriesID" binding:"required"`
+	Query          SeriesQueryRequestDataDao `json:"query" binding:"required"`
+	MaxPages       int                       `json:"maxPages"`
+	Since          *time.Time                `json:"since"`
+	MaxSize        uint64                    `json:"maxSize"`
+	DedupeEpisodes bool                      `json:"dedupeEpisodes"`
+}
+
+type ConfirmBackfillRequestDao struct {
+	IDs []string `json:"ids"`
+}
+
+type MetadataSearchRequestDao struct {
+	Query    string `json:"query" binding:"required"`
+	Provider string `json:"provider"`
+}
+
+type LinkMetadataRequestDao struct {
+	SeriesID   uint   `json:"seriesID" binding:"required"`
+	Provider   string `json:"provider"`
+	ExternalID string `json:"externalID" binding:"required"`
+}
+
+type RefreshMetadataRequestDao struct {
+	SeriesID uint `json:"seriesID" binding:"required"`
 }
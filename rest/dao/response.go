@@ -8,22 +8,32 @@ import (
 )
 
 type SeriesResponseDao struct {
-	ID         uint            `json:"id"`
-	Title      string          `json:"title"`
-	Thumb      string          `json:"thumb"`
-	LastUpdate time.Time       `json:"lastUpdate"`
-	Query      *db.SeriesQuery `json:"query"`
+	ID         uint               `json:"id"`
+	Title      string             `json:"title"`
+	Thumb      string             `json:"thumb"`
+	LastUpdate time.Time          `json:"lastUpdate"`
+	Query      *db.SeriesQuery    `json:"query"`
+	Metadata   *db.SeriesMetadata `json:"metadata"`
+	Seeding    *db.SeedingPolicy  `json:"seeding"`
+	Archive    bool               `json:"archive"`
 }
 
 type TorrentResponseDao struct {
 	ID                  uint                     `json:"id"`
 	Name                string                   `json:"name"`
 	Status              db.TorrentStatus         `json:"status"`
+	Priority            int                      `json:"priority"`
+	DownloadBpsLimit    int                      `json:"downloadBpsLimit"`
+	UploadBpsLimit      int                      `json:"uploadBpsLimit"`
 	Source              *string                  `json:"source"`
 	TotalLength         uint                     `json:"totalLength"`
 	TotalDownloadLength uint                     `json:"totalDownloadLength"`
 	Progress            util.Progress            `json:"progress"`
 	BytesRead           uint                     `json:"bytesRead"`
+	BytesUploaded       uint                     `json:"bytesUploaded"`
+	Ratio               float64                  `json:"ratio"`
+	Seeding             bool                     `json:"seeding"`
+	Local               bool                     `json:"local"`
 	Files               []TorrentFileResponseDao `json:"files"`
 	UpdatedAt           time.Time                `json:"updatedAt"`
 }
@@ -32,11 +42,18 @@ type TorrentResponseWithoutFilesDao struct {
 	ID                  uint             `json:"id"`
 	Name                string           `json:"name"`
 	Status              db.TorrentStatus `json:"status"`
+	Priority            int              `json:"priority"`
+	DownloadBpsLimit    int              `json:"downloadBpsLimit"`
+	UploadBpsLimit      int              `json:"uploadBpsLimit"`
 	Source              *string          `json:"source"`
 	TotalLength         uint             `json:"totalLength"`
 	TotalDownloadLength uint             `json:"totalDownloadLength"`
 	Progress            util.Progress    `json:"progress"`
 	BytesRead           uint             `json:"bytesRead"`
+	BytesUploaded       uint             `json:"bytesUploaded"`
+	Ratio               float64          `json:"ratio"`
+	Seeding             bool             `json:"seeding"`
+	Local               bool             `json:"local"`
 	UpdatedAt           time.Time        `json:"updatedAt"`
 }
 
@@ -94,11 +111,60 @@ type UserResponseDao struct {
 }
 
 type SearchResultDao struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Provider  string    `json:"provider"`
+	Seeders   int       `json:"seeders"`
+	Leechers  int       `json:"leechers"`
+	Completed int       `json:"completed"`
+	Size      uint64    `json:"size"`
+	Date      time.Time `json:"date"`
+	Category  string    `json:"category"`
+	Trusted   bool      `json:"trusted"`
+	Remake    bool      `json:"remake"`
+	InfoHash  string    `json:"infoHash"`
+	Link      string    `json:"link"`
+}
+
+type QueryTestCandidateDao struct {
+	Source   string               `json:"source"`
+	ID       string               `json:"id"`
+	Title    string               `json:"title"`
+	Link     string               `json:"link"`
+	Provider string               `json:"provider"`
+	Matched  bool                 `json:"matched"`
+	Reason   string               `json:"reason"`
+	Metadata meta.EpisodeMetadata `json:"metadata"`
+	Release  meta.ReleaseInfo     `json:"release"`
+}
+
+type BackfillItemDao struct {
+	ID      string           `json:"id"`
+	Title   string           `json:"title"`
+	Link    string           `json:"link"`
+	Size    uint64           `json:"size"`
+	Date    time.Time        `json:"date"`
+	Release meta.ReleaseInfo `json:"release"`
+	Added   bool             `json:"added"`
+	Error   string           `json:"error"`
+}
+
+type BackfillResponseDao struct {
+	ID       uint              `json:"id"`
+	SeriesId uint              `json:"seriesId"`
+	Provider string            `json:"provider"`
+	Status   string            `json:"status"`
+	Progress int               `json:"progress"`
+	Error    string            `json:"error"`
+	Items    []BackfillItemDao `json:"items"`
+}
+
+type MetadataSearchResultDao struct {
 	ID       string `json:"id"`
-	Title    string `json:"title"`
 	Provider string `json:"provider"`
-	Seeders  int    `json:"seeders"`
-	Size     string `json:"size"`
-	Date     string `json:"date"`
-	Link     string `json:"link"`
+	Title    string `json:"title"`
+	Year     int    `json:"year"`
+	Season   string `json:"season"`
+	Episodes int    `json:"episodes"`
+	Poster   string `json:"poster"`
 }
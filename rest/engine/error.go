@@ -48,6 +48,20 @@ func ErrForbidden(msg string) *StatusError {
 	}
 }
 
+func ErrConflict(msg string) *StatusError {
+	return &StatusError{
+		StatusCode: http.StatusConflict,
+		Message:    msg,
+	}
+}
+
+func ErrInsufficientStorage(msg string) *StatusError {
+	return &StatusError{
+		StatusCode: http.StatusInsufficientStorage,
+		Message:    msg,
+	}
+}
+
 func ErrInternal(msg string) *StatusError {
 	return &StatusError{
 		StatusCode: http.StatusInternalServerError,
@@ -70,4 +84,6 @@ var (
 	ErrUserWithThisEmailAlreadyExists = ErrBadRequest("user with this email already exists")
 	ErrUserWithThisLoginAlreadyExists = ErrBadRequest("user with this login already exists")
 	ErrSessionSavingFailed            = ErrInternal("session saving failed")
+	ErrTorrentAlreadyExists           = ErrConflict("torrent already exists")
+	ErrNotEnoughSpace                 = ErrInsufficientStorage("not enough free space")
 )
@@ -6,6 +6,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
+	"github.com/anacrolix/torrent/metainfo"
 	"github.com/mmcdole/gofeed"
 	goCache "github.com/patrickmn/go-cache"
 	"go.uber.org/fx"
@@ -13,17 +14,20 @@ import (
 	"golang.org/x/time/rate"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 type Service struct {
-	config      *config.Config
-	log         *zap.Logger
-	rateLimiter *rate.Limiter
-	client      *http.Client
-	cache       *goCache.Cache
+	config       *config.Config
+	log          *zap.Logger
+	rateLimiter  *rate.Limiter
+	client       *http.Client
+	cache        *goCache.Cache
+	activeMirror int32 // activeMirror Index of the last working mirror
 }
 
 var _ search.Provider = (*Service)(nil)
@@ -48,23 +52,133 @@ func NewService(
 	}, nil
 }
 
-const baseUrl = "https://nyaa.si"
+const ProviderName = "nyaa"
+
+var categoryRegex = regexp.MustCompile(`^\d+_\d+$`)
+
+// defaultCategory Anime, feed of default category and filter was polled at /rss before categories were configurable
+const defaultCategory = "1_0"
+
+var siteFilters = map[search.SiteFilter]string{
+	search.SiteFilterNone:        "0",
+	search.SiteFilterNoRemakes:   "1",
+	search.SiteFilterTrustedOnly: "2",
+}
+
+// baseUrl Primary base url, links and feed urls always use it, so that they don't depend on the mirror used
+func (s *Service) baseUrl() string {
+	return strings.TrimSuffix(s.config.Search.Nyaa.BaseUrl, "/")
+}
+
+func (s *Service) mirrors() []string {
+	mirrors := []string{s.baseUrl()}
+	for _, mirror := range s.config.Search.Nyaa.Mirrors {
+		mirrors = append(mirrors, strings.TrimSuffix(mirror, "/"))
+	}
+	return mirrors
+}
+
+// withMirrors Calls f with base url of each mirror, starting from the last working one, until one succeeds
+func (s *Service) withMirrors(ctx context.Context, f func(baseUrl string) error) error {
+	mirrors := s.mirrors()
+	start := int(atomic.LoadInt32(&s.activeMirror)) % len(mirrors)
+
+	var err error
+
+	for i := 0; i < len(mirrors); i++ {
+		index := (start + i) % len(mirrors)
+
+		err = f(mirrors[index])
+		if err == nil {
+			if index != start {
+				atomic.StoreInt32(&s.activeMirror, int32(index))
+				s.log.Info("switched nyaa mirror", zap.String("mirror", mirrors[index]))
+			}
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return err
+		}
+
+		s.log.Warn("nyaa mirror request failed",
+			zap.String("mirror", mirrors[index]),
+			zap.Error(err))
+	}
+
+	return err
+}
+
+// mirrorUrl Replaces primary base url with the mirror one, custom urls are left as is
+func (s *Service) mirrorUrl(link string, mirror string) string {
+	if !strings.HasPrefix(link, s.baseUrl()) {
+		return link
+	}
+	return mirror + strings.TrimPrefix(link, s.baseUrl())
+}
+
+// listParams Returns category and filter params, empty values are taken from config
+func (s *Service) listParams(category string, filter search.SiteFilter) (url.Values, error) {
+	if category == "" {
+		category = s.config.Search.Nyaa.Category
+	}
+	if filter == search.SiteFilterDefault {
+		filter = search.SiteFilter(s.config.Search.Nyaa.Filter)
+	}
+
+	if !categoryRegex.MatchString(category) {
+		return nil, fmt.Errorf("invalid nyaa category: %s", category)
+	}
+
+	filterValue, exists := siteFilters[filter]
+	if !exists {
+		return nil, fmt.Errorf("invalid nyaa filter: %s", filter)
+	}
+
+	params := make(url.Values)
+	params.Set("c", category)
+	params.Set("f", filterValue)
+
+	return params, nil
+}
+
+func (s *Service) Name() string {
+	return ProviderName
+}
 
 func (s *Service) Search(ctx context.Context, query search.Query) ([]search.Result, error) {
 	const torrentsSelector = "body > div > div.table-responsive > table > tbody > tr"
+	const categorySelector = "td:nth-child(1) > a"
 	const viewLinkSelector = "td:nth-child(2) > a:last-child"
+	const magnetSelector = "td:nth-child(3) > a[href^='magnet:']"
 	const sizeSelector = "td:nth-child(4)"
 	const dateSelector = "td:nth-child(5)"
 	const seedersSelector = "td:nth-child(6)"
+	const leechersSelector = "td:nth-child(7)"
+	const completedSelector = "td:nth-child(8)"
 
-	req, err := s.genRequest(ctx, query)
+	urlQuery, err := s.searchParams(query)
 	if err != nil {
-		return nil, fmt.Errorf("error generating request: %w", err)
+		return nil, err
 	}
 
-	doc, err := search.LoadDocument(ctx, s.client, s.rateLimiter, s.log, req)
+	var doc *goquery.Document
+
+	err = s.withMirrors(ctx, func(baseUrl string) error {
+		req, err := http.NewRequestWithContext(ctx, "GET", baseUrl+"/?"+urlQuery.Encode(), nil)
+		if err != nil {
+			return fmt.Errorf("error generating request: %w", err)
+		}
+
+		doc, err = search.LoadDocument(ctx, s.client, s.rateLimiter, s.log, req)
+		if err != nil {
+			return fmt.Errorf("failed to laod document: %w", err)
+		}
+
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to laod document: %w", err)
+		return nil, err
 	}
 
 	results := make([]search.Result, 0, 75)
@@ -75,20 +189,47 @@ func (s *Service) Search(ctx context.Context, query search.Query) ([]search.Resu
 
 		viewLinkRelative, _ := linkHtml.Attr("href")
 		viewLinkRelative = strings.TrimSpace(viewLinkRelative)
-		viewLink := baseUrl + viewLinkRelative
+		viewLink := s.baseUrl() + viewLinkRelative
+
+		categoryLink, _ := sel.Find(categorySelector).Attr("href")
+		category := strings.TrimPrefix(strings.TrimSpace(categoryLink), "/?c=")
 
-		size := strings.TrimSpace(sel.Find(sizeSelector).Text())
-		date := strings.TrimSpace(sel.Find(dateSelector).Text())
-		seedersStr := strings.TrimSpace(sel.Find(seedersSelector).Text())
-		seeders, _ := strconv.Atoi(seedersStr)
+		var infoHash string
+		magnetLink, _ := sel.Find(magnetSelector).Attr("href")
+		if magnet, err := metainfo.ParseMagnetUri(magnetLink); err == nil {
+			infoHash = magnet.InfoHash.HexString()
+		}
 
+		size, _ := search.ParseSize(strings.TrimSpace(sel.Find(sizeSelector).Text()))
+
+		dateHtml := sel.Find(dateSelector)
+		var date time.Time
+		if timestampStr, exists := dateHtml.Attr("data-timestamp"); exists {
+			timestamp, _ := strconv.ParseInt(timestampStr, 10, 64)
+			date = time.Unix(timestamp, 0).UTC()
+		} else {
+			date, _ = search.ParseDate(strings.TrimSpace(dateHtml.Text()))
+		}
+
+		seeders, _ := strconv.Atoi(strings.TrimSpace(sel.Find(seedersSelector).Text()))
+		leechers, _ := strconv.Atoi(strings.TrimSpace(sel.Find(leechersSelector).Text()))
+		completed, _ := strconv.Atoi(strings.TrimSpace(sel.Find(completedSelector).Text()))
+
+		// row class is based on uploader status
 		results = append(results, search.Result{
-			ID:      strings.TrimPrefix(viewLinkRelative, "/view/"),
-			Title:   title,
-			Seeders: seeders,
-			Size:    size,
-			Date:    date,
-			Link:    viewLink,
+			ID:            strings.TrimPrefix(viewLinkRelative, "/view/"),
+			Title:         title,
+			Seeders:       seeders,
+			Leechers:      leechers,
+			Completed:     completed,
+			Size:          size,
+			Date:          date,
+			Category:      category,
+			Trusted:       sel.HasClass("success"),
+			TrustReported: true,
+			Remake:        sel.HasClass("danger"),
+			InfoHash:      infoHash,
+			Link:          viewLink,
 		})
 	})
 
@@ -100,14 +241,23 @@ func (s *Service) Search(ctx context.Context, query search.Query) ([]search.Resu
 }
 
 func (s *Service) DownloadById(ctx context.Context, id string) ([]byte, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/download/%s.torrent", baseUrl, id), nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create download request: %w", err)
-	}
+	var bytes []byte
 
-	bytes, err := search.DownloadFile(ctx, s.client, s.rateLimiter, req)
+	err := s.withMirrors(ctx, func(baseUrl string) error {
+		req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/download/%s.torrent", baseUrl, id), nil)
+		if err != nil {
+			return fmt.Errorf("failed to create download request: %w", err)
+		}
+
+		bytes, err = search.DownloadFile(ctx, s.client, s.rateLimiter, req)
+		if err != nil {
+			return fmt.Errorf("failed to download file: %w", err)
+		}
+
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to download file: %w", err)
+		return nil, err
 	}
 
 	return bytes, nil
@@ -117,15 +267,25 @@ func (s *Service) GetById(ctx context.Context, id string) (search.ResultById, er
 	const filesSelector = "div.torrent-file-list.panel-body > ul > li"
 	const downloadLinkSelector = "body > div > div.panel.panel-success > div.panel-footer.clearfix > a:nth-child(1)"
 
-	viewLink := baseUrl + "/view/" + id
-	req, err := http.NewRequestWithContext(ctx, "GET", viewLink, nil)
-	if err != nil {
-		return search.ResultById{}, fmt.Errorf("failed to create extra request: %w", err)
-	}
+	var doc *goquery.Document
+	var docBaseUrl string
+
+	err := s.withMirrors(ctx, func(baseUrl string) error {
+		req, err := http.NewRequestWithContext(ctx, "GET", baseUrl+"/view/"+id, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create extra request: %w", err)
+		}
+
+		doc, err = search.LoadDocument(ctx, s.client, s.rateLimiter, s.log, req)
+		if err != nil {
+			return fmt.Errorf("failed to laod document: %w", err)
+		}
 
-	doc, err := search.LoadDocument(ctx, s.client, s.rateLimiter, s.log, req)
+		docBaseUrl = baseUrl
+		return nil
+	})
 	if err != nil {
-		return search.ResultById{}, fmt.Errorf("failed to laod document: %w", err)
+		return search.ResultById{}, err
 	}
 
 	files := make([]string, 0, 32)
@@ -138,7 +298,7 @@ func (s *Service) GetById(ctx context.Context, id string) (search.ResultById, er
 	relativeDownloadUrl, _ := downloadLink.Attr("href")
 	relativeDownloadUrl = strings.TrimSpace(relativeDownloadUrl)
 
-	downloadUrl := baseUrl + relativeDownloadUrl
+	downloadUrl := docBaseUrl + relativeDownloadUrl
 
 	return search.ResultById{
 		DownloadUrl: downloadUrl,
@@ -146,54 +306,100 @@ func (s *Service) GetById(ctx context.Context, id string) (search.ResultById, er
 	}, nil
 }
 
-func (s *Service) GetRSS(ctx context.Context) ([]search.ResultRSS, error) {
-	parser := gofeed.NewParser()
-	parser.Client = s.client
+// RSSUrl Feed is the search page in rss mode, params are e.g. q=query or u=user.
+// Shared feed with default category and filter is the plain /rss, since feed url is the key of stored poll cursor
+func (s *Service) RSSUrl(feed search.Feed) (string, error) {
+	urlQuery, err := s.listParams(feed.Category, feed.Filter)
+	if err != nil {
+		return "", err
+	}
+	if feed.IsShared() && urlQuery.Get("c") == defaultCategory && urlQuery.Get("f") == siteFilters[search.SiteFilterNone] {
+		return s.baseUrl() + "/rss", nil
+	}
+	urlQuery.Set("page", "rss")
+	return search.BuildFeedUrl(s.baseUrl()+"/?"+urlQuery.Encode(), feed)
+}
 
-	feed, err := parser.ParseURLWithContext(baseUrl+"/rss", ctx)
+func (s *Service) GetRSS(ctx context.Context, rssFeed search.Feed) ([]search.ResultRSS, error) {
+	feedUrl, err := s.RSSUrl(rssFeed)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load rss: %w", err)
+		return nil, err
+	}
+
+	var feed *gofeed.Feed
+
+	err = s.withMirrors(ctx, func(baseUrl string) error {
+		parser := gofeed.NewParser()
+		parser.Client = s.client
+
+		feed, err = parser.ParseURLWithContext(s.mirrorUrl(feedUrl, baseUrl), ctx)
+		if err != nil {
+			return fmt.Errorf("failed to load rss: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	results := make([]search.ResultRSS, 0, len(feed.Items))
 
 	for _, item := range feed.Items {
+		size, _ := search.ParseSize(rssExtension(item, "size"))
+		seeders, _ := strconv.Atoi(rssExtension(item, "seeders"))
+		id := item.GUID[strings.LastIndex(item.GUID, "/")+1:]
+
 		results = append(results, search.ResultRSS{
-			ID:        strings.TrimPrefix(item.GUID, baseUrl+"/view/"),
-			Title:     item.Title,
-			Link:      item.GUID,
-			Timestamp: item.PublishedParsed,
+			ID:            id,
+			Title:         item.Title,
+			Link:          s.baseUrl() + "/view/" + id,
+			Timestamp:     item.PublishedParsed,
+			Size:          size,
+			Seeders:       seeders,
+			Trusted:       rssExtension(item, "trusted") == "Yes",
+			TrustReported: true,
+			Remake:        rssExtension(item, "remake") == "Yes",
+			InfoHash:      strings.ToLower(rssExtension(item, "infoHash")),
 		})
 	}
 
 	return results, nil
 }
 
-func (s *Service) genRequest(ctx context.Context, query search.Query) (*http.Request, error) {
-	urlQuery := make(url.Values)
+// rssExtension Returns value of nyaa:name element of the feed item
+func rssExtension(item *gofeed.Item, name string) string {
+	values := item.Extensions["nyaa"][name]
+	if len(values) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(values[0].Value)
+}
+
+func (s *Service) searchParams(query search.Query) (url.Values, error) {
+	urlQuery, err := s.listParams(query.Category, query.Filter)
+	if err != nil {
+		return nil, err
+	}
 
-	// anime
-	urlQuery.Set("c", "1_0")
 	urlQuery.Set("q", query.Query)
-	// probably trust status
-	urlQuery.Set("f", "0")
 	urlQuery.Set("o", "desc")
 	urlQuery.Set("p", strconv.Itoa(query.Page+1))
 
-	if query.SortType == search.SortSeeders {
+	switch query.SortType {
+	case search.SortSeeders:
 		urlQuery.Set("s", "seeders")
-	} else {
+	case search.SortSize:
+		urlQuery.Set("s", "size")
+	case search.SortLeechers:
+		urlQuery.Set("s", "leechers")
+	case search.SortCompleted:
+		urlQuery.Set("s", "downloads")
+	default:
 		urlQuery.Set("s", "id")
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", baseUrl, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.URL.RawQuery = urlQuery.Encode()
-
-	return req, nil
+	return urlQuery, nil
 }
 
-var Export = fx.Options(fx.Provide(NewService))
+var Export = fx.Options(fx.Provide(search.AsProvider(NewService)))
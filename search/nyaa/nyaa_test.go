@@ -3,71 +3,271 @@ package nyaa
 import (
 	"anileha/config"
 	"anileha/search"
+	"anileha/search/searchtest"
 	"context"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"net/http"
 	"testing"
 )
 
-func TestSearch(t *testing.T) {
-	ctx := context.Background()
+func newFixtureServer(t *testing.T) *searchtest.FixtureServer {
+	server := searchtest.NewFixtureServer(t)
+
+	server.Handle("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "rss" {
+			server.WriteFixture(w, "rss.xml", "application/rss+xml")
+		} else {
+			server.WriteFixture(w, "search.html", "text/html")
+		}
+	})
+	server.Serve("/rss", "rss.xml", "application/rss+xml")
+	server.Serve("/view/1653158", "view.html", "text/html")
+	server.Handle("/download/1653158.torrent", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(searchtest.GenTorrentBytes(t, "1653158", "Blue Lock 24.mkv"))
+	})
+
+	return server
+}
+
+func newTestService(t *testing.T) (*Service, *searchtest.FixtureServer) {
+	server := newFixtureServer(t)
+
 	cfg := config.GetDefaultConfig()
+	cfg.Search.RateLimit.IntervalMs = 1
+	cfg.Search.Nyaa.BaseUrl = server.URL
 
 	service, err := NewService(&cfg, zap.NewNop())
 	require.Nil(t, err)
 
+	return service, server
+}
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	service, server := newTestService(t)
+
 	res, err := service.Search(ctx, search.Query{
 		Query:    "blue lock erai 1080",
-		SortType: search.SortDate,
+		SortType: search.SortSeeders,
+		Page:     1,
 	})
 	require.Nil(t, err)
+	require.Equal(t, 3, len(res))
+
+	requests := server.Requests()
+	require.Equal(t, 1, len(requests))
+	assert.Equal(t, "blue lock erai 1080", requests[0].URL.Query().Get("q"))
+	assert.Equal(t, "seeders", requests[0].URL.Query().Get("s"))
+	assert.Equal(t, "2", requests[0].URL.Query().Get("p"))
+	assert.Equal(t, "1_0", requests[0].URL.Query().Get("c"))
+	assert.Equal(t, "0", requests[0].URL.Query().Get("f"))
 
 	first := res[0]
 
 	assert.Equal(t, "1653158", first.ID)
 	assert.Equal(t, "[Erai-raws] Blue Lock - 24 END [1080p][Multiple Subtitle] [ENG][POR-BR][SPA-LA][SPA][FRE][GER][ITA][RUS]", first.Title)
-	assert.Equal(t, "2023-03-25 18:00", first.Date)
-	assert.Equal(t, "https://nyaa.si/view/1653158", first.Link)
+	assert.Equal(t, 456, first.Seeders)
+	assert.Equal(t, 14, first.Leechers)
+	assert.Equal(t, 9876, first.Completed)
+	assert.Equal(t, uint64(1395864371), first.Size)
+	assert.Equal(t, int64(1679767200), first.Date.Unix())
+	assert.Equal(t, "1_2", first.Category)
+	assert.Equal(t, "5cc77890c2a4f0b0e0d8c1e6b7a3f2d1e0c9b8a7", first.InfoHash)
+	assert.True(t, first.Trusted)
+	assert.False(t, first.Remake)
+	assert.Equal(t, server.URL+"/view/1653158", first.Link)
+
+	assert.False(t, res[1].Trusted)
+	assert.False(t, res[1].Remake)
+	assert.True(t, res[2].Remake)
+	assert.Equal(t, "1_3", res[2].Category)
 }
 
 func TestGetById(t *testing.T) {
 	ctx := context.Background()
-	cfg := config.GetDefaultConfig()
-
-	service, err := NewService(&cfg, zap.NewNop())
-	require.Nil(t, err)
+	service, server := newTestService(t)
 
 	extra, err := service.GetById(ctx, "1653158")
 	require.Nil(t, err)
 
-	assert.Equal(t, "https://nyaa.si/download/1653158.torrent", extra.DownloadUrl)
+	assert.Equal(t, server.URL+"/download/1653158.torrent", extra.DownloadUrl)
 	require.Equal(t, 1, len(extra.Files))
 	assert.Equal(t, "[Erai-raws] Blue Lock - 24 END [1080p][Multiple Subtitle][5CC77890].mkv (1.3 GiB)", extra.Files[0])
 }
 
 func TestDownloadById(t *testing.T) {
 	ctx := context.Background()
+	service, _ := newTestService(t)
+
+	torrentBytes, err := service.DownloadById(ctx, "1653158")
+	require.Nil(t, err)
+
+	assert.Equal(t, searchtest.GenTorrentBytes(t, "1653158", "Blue Lock 24.mkv"), torrentBytes)
+}
+
+func TestGetRSS(t *testing.T) {
+	ctx := context.Background()
+	service, _ := newTestService(t)
+
+	feed, err := service.GetRSS(ctx, search.Feed{})
+	require.Nil(t, err)
+	require.Equal(t, 4, len(feed))
+
+	first := feed[0]
+
+	assert.Equal(t, "1654003", first.ID)
+	assert.Equal(t, "[SubsPlease] Jigokuraku - 02 (1080p) [E5F6A7B8].mkv", first.Title)
+	require.NotNil(t, first.Timestamp)
+	assert.Equal(t, int64(1680967867), first.Timestamp.Unix())
+	assert.Equal(t, 804, first.Seeders)
+	assert.Equal(t, uint64(1503238553), first.Size)
+	assert.Equal(t, "e5f6a7b8c9d0e1f2a3b4c5d6e7f8091a2b3c4d5e", first.InfoHash)
+	assert.True(t, first.Trusted)
+	assert.False(t, first.Remake)
+
+	assert.False(t, feed[3].Trusted)
+}
+
+func TestGetRSSCustomFeed(t *testing.T) {
+	ctx := context.Background()
+	service, server := newTestService(t)
+
+	feed := search.Feed{
+		Params:   map[string]string{"q": "jigokuraku", "u": "subsplease"},
+		Category: "1_2",
+		Filter:   search.SiteFilterTrustedOnly,
+	}
+
+	feedUrl, err := service.RSSUrl(feed)
+	require.Nil(t, err)
+	assert.Equal(t, server.URL+"/?c=1_2&f=2&page=rss&q=jigokuraku&u=subsplease", feedUrl)
+
+	results, err := service.GetRSS(ctx, feed)
+	require.Nil(t, err)
+	require.Equal(t, 4, len(results))
+
+	requests := server.Requests()
+	require.Equal(t, 1, len(requests))
+	assert.Equal(t, "rss", requests[0].URL.Query().Get("page"))
+	assert.Equal(t, "jigokuraku", requests[0].URL.Query().Get("q"))
+	assert.Equal(t, "subsplease", requests[0].URL.Query().Get("u"))
+	assert.Equal(t, "1_2", requests[0].URL.Query().Get("c"))
+	assert.Equal(t, "2", requests[0].URL.Query().Get("f"))
+}
+
+func TestConfigListParams(t *testing.T) {
+	ctx := context.Background()
+	service, server := newTestService(t)
+	service.config.Search.Nyaa.Category = "1_4"
+	service.config.Search.Nyaa.Filter = string(search.SiteFilterNoRemakes)
+
+	feedUrl, err := service.RSSUrl(search.Feed{})
+	require.Nil(t, err)
+	assert.Equal(t, server.URL+"/?c=1_4&f=1&page=rss", feedUrl)
+
+	_, err = service.Search(ctx, search.Query{Query: "blue lock", Filter: search.SiteFilterTrustedOnly})
+	require.Nil(t, err)
+
+	requests := server.Requests()
+	require.Equal(t, 1, len(requests))
+	assert.Equal(t, "1_4", requests[0].URL.Query().Get("c"))
+	assert.Equal(t, "2", requests[0].URL.Query().Get("f"))
+}
+
+func TestInvalidListParams(t *testing.T) {
+	ctx := context.Background()
+	service, _ := newTestService(t)
+
+	_, err := service.RSSUrl(search.Feed{Category: "anime"})
+	require.NotNil(t, err)
+
+	_, err = service.RSSUrl(search.Feed{Filter: "everything"})
+	require.NotNil(t, err)
+
+	_, err = service.Search(ctx, search.Query{Query: "blue lock", Category: "anime"})
+	require.NotNil(t, err)
+}
+
+func TestMirrorFailover(t *testing.T) {
+	ctx := context.Background()
+
+	primary := searchtest.NewFixtureServer(t)
+	badGateway := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	primary.Handle("/", badGateway)
+	primary.Handle("/rss", badGateway)
+	mirror := newFixtureServer(t)
+
 	cfg := config.GetDefaultConfig()
+	cfg.Search.RateLimit.IntervalMs = 1
+	cfg.Search.Nyaa.BaseUrl = primary.URL
+	cfg.Search.Nyaa.Mirrors = []string{mirror.URL + "/"}
 
 	service, err := NewService(&cfg, zap.NewNop())
 	require.Nil(t, err)
 
-	torrentBytes, err := service.DownloadById(ctx, "1653158")
+	feed, err := service.GetRSS(ctx, search.Feed{})
+	require.Nil(t, err)
+	require.Equal(t, 4, len(feed))
+
+	// links point to the primary url regardless of the mirror used
+	assert.Equal(t, "1654003", feed[0].ID)
+	assert.Equal(t, primary.URL+"/view/1654003", feed[0].Link)
+
+	res, err := service.Search(ctx, search.Query{Query: "blue lock"})
+	require.Nil(t, err)
+	require.Equal(t, 3, len(res))
+	assert.Equal(t, primary.URL+"/view/1653158", res[0].Link)
+
+	extra, err := service.GetById(ctx, "1653158")
+	require.Nil(t, err)
+	assert.Equal(t, mirror.URL+"/download/1653158.torrent", extra.DownloadUrl)
+
+	_, err = service.DownloadById(ctx, "1653158")
 	require.Nil(t, err)
 
-	assert.Equal(t, 27858, len(torrentBytes))
+	// working mirror is remembered
+	assert.Equal(t, 1, len(primary.Requests()))
+	assert.Equal(t, 4, len(mirror.Requests()))
 }
 
-func TestGetRSS(t *testing.T) {
+func TestDownloadMirrorFailover(t *testing.T) {
 	ctx := context.Background()
+
+	primary := searchtest.NewFixtureServer(t)
+	primary.Handle("/download/1653158.torrent", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte("<html>slow down</html>"))
+	})
+	mirror := newFixtureServer(t)
+
 	cfg := config.GetDefaultConfig()
+	cfg.Search.RateLimit.IntervalMs = 1
+	cfg.Search.Nyaa.BaseUrl = primary.URL
+	cfg.Search.Nyaa.Mirrors = []string{mirror.URL}
 
 	service, err := NewService(&cfg, zap.NewNop())
 	require.Nil(t, err)
 
-	feed, err := service.GetRSS(ctx)
+	torrentBytes, err := service.DownloadById(ctx, "1653158")
+	require.Nil(t, err)
+	assert.Equal(t, searchtest.GenTorrentBytes(t, "1653158", "Blue Lock 24.mkv"), torrentBytes)
+	assert.Equal(t, 1, len(primary.Requests()))
+	assert.Equal(t, 1, len(mirror.Requests()))
+}
+
+func TestDefaultRSSUrl(t *testing.T) {
+	service, server := newTestService(t)
+
+	// cursors of the default feed are stored under its url
+	feedUrl, err := service.RSSUrl(search.Feed{})
 	require.Nil(t, err)
+	assert.Equal(t, server.URL+"/rss", feedUrl)
 
-	assert.Equal(t, 75, len(feed))
+	feedUrl, err = service.RSSUrl(search.Feed{Filter: search.SiteFilterTrustedOnly})
+	require.Nil(t, err)
+	assert.Equal(t, server.URL+"/?c=1_0&f=2&page=rss", feedUrl)
 }
@@ -0,0 +1,69 @@
+package search
+
+import (
+	"anileha/config"
+	"anileha/util"
+	"fmt"
+	"go.uber.org/fx"
+	"sort"
+)
+
+// Registry Stores all available search providers by their names
+type Registry struct {
+	config    *config.Config
+	providers map[string]Provider
+}
+
+type RegistryParams struct {
+	fx.In
+	Config    *config.Config
+	Providers []Provider `group:"providers"`
+}
+
+func NewRegistry(params RegistryParams) (*Registry, error) {
+	providers := make(map[string]Provider, len(params.Providers))
+	for _, provider := range params.Providers {
+		name := provider.Name()
+		if _, exists := providers[name]; exists {
+			return nil, fmt.Errorf("duplicate search provider: %s", name)
+		}
+		providers[name] = provider
+	}
+	return &Registry{
+		config:    params.Config,
+		providers: providers,
+	}, nil
+}
+
+// Get Returns provider by its name, falls back to the default provider if name is empty
+func (r *Registry) Get(name string) (Provider, error) {
+	if name == "" {
+		name = r.config.Search.DefaultProvider
+	}
+	provider, exists := r.providers[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", util.ErrUnknownProvider, name)
+	}
+	return provider, nil
+}
+
+// Names Returns sorted names of all registered providers
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AsProvider Annotates provider constructor so that it gets collected by Registry
+func AsProvider(constructor any) any {
+	return fx.Annotate(
+		constructor,
+		fx.As(new(Provider)),
+		fx.ResultTags(`group:"providers"`),
+	)
+}
+
+var RegistryExport = fx.Options(fx.Provide(NewRegistry))
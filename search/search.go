@@ -10,12 +10,17 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
 type Provider interface {
-	GetRSS(ctx context.Context) ([]ResultRSS, error)
+	Name() string
+	// RSSUrl Returns url of the given RSS feed, which identifies the feed for polling
+	RSSUrl(feed Feed) (string, error)
+	GetRSS(ctx context.Context, feed Feed) ([]ResultRSS, error)
 	Search(ctx context.Context, query Query) ([]Result, error)
 	GetById(ctx context.Context, id string) (ResultById, error)
 	DownloadById(ctx context.Context, id string) ([]byte, error)
@@ -24,14 +29,43 @@ type Provider interface {
 type Sort int
 
 const (
-	SortDate    Sort = 0
-	SortSeeders Sort = 1
+	SortDate      Sort = 0
+	SortSeeders   Sort = 1
+	SortSize      Sort = 2
+	SortLeechers  Sort = 3
+	SortCompleted Sort = 4
 )
 
+// SiteFilter Filter applied by the provider itself, unlike Filter, which is applied to already loaded results
+type SiteFilter string
+
+const (
+	SiteFilterDefault     SiteFilter = ""
+	SiteFilterNone        SiteFilter = "none"
+	SiteFilterNoRemakes   SiteFilter = "noRemakes"
+	SiteFilterTrustedOnly SiteFilter = "trustedOnly"
+)
+
+// Query Empty Category and Filter mean provider's configured defaults
 type Query struct {
 	Query    string
 	SortType Sort
 	Page     int
+	Category string
+	Filter   SiteFilter
+}
+
+// Feed Custom RSS feed, either a full url or provider-specific params (e.g. q or u for nyaa).
+// Category and Filter override provider's configured defaults. Zero value means provider's shared feed
+type Feed struct {
+	Url      string
+	Params   map[string]string
+	Category string
+	Filter   SiteFilter
+}
+
+func (f Feed) IsShared() bool {
+	return f.Url == "" && len(f.Params) == 0 && f.Category == "" && f.Filter == SiteFilterDefault
 }
 
 type ResultRSS struct {
@@ -39,6 +73,13 @@ type ResultRSS struct {
 	Title     string
 	Link      string
 	Timestamp *time.Time
+	Size      uint64
+	Seeders   int
+	Trusted   bool
+	// TrustReported Whether provider reports uploader status at all, Trusted is always false otherwise
+	TrustReported bool
+	Remake        bool
+	InfoHash      string
 }
 
 type ResultById struct {
@@ -47,12 +88,75 @@ type ResultById struct {
 }
 
 type Result struct {
-	ID      string
-	Title   string
-	Seeders int
-	Size    string
-	Date    string
-	Link    string
+	ID        string
+	Title     string
+	Seeders   int
+	Leechers  int
+	Completed int
+	Size      uint64
+	Date      time.Time
+	Category  string
+	Trusted   bool
+	// TrustReported Whether provider reports uploader status at all, Trusted is always false otherwise
+	TrustReported bool
+	Remake        bool
+	InfoHash      string
+	Link          string
+}
+
+// RSS Converts result, so that it can be matched the same way as feed items
+func (r Result) RSS() ResultRSS {
+	var timestamp *time.Time
+	if !r.Date.IsZero() {
+		date := r.Date
+		timestamp = &date
+	}
+	return ResultRSS{
+		ID:            r.ID,
+		Title:         r.Title,
+		Link:          r.Link,
+		Timestamp:     timestamp,
+		Size:          r.Size,
+		Seeders:       r.Seeders,
+		Trusted:       r.Trusted,
+		TrustReported: r.TrustReported,
+		Remake:        r.Remake,
+		InfoHash:      r.InfoHash,
+	}
+}
+
+// Filter Zero values disable corresponding checks, uploader status and remakes are filtered with SiteFilter
+type Filter struct {
+	MinSeeders int
+	MaxSize    uint64
+}
+
+func (f Filter) Test(result Result) bool {
+	if result.Seeders < f.MinSeeders {
+		return false
+	}
+	if f.MaxSize > 0 && result.Size > f.MaxSize {
+		return false
+	}
+	return true
+}
+
+// SortResults Sorts results in descending order, used by providers that can't sort on their side
+func SortResults(results []Result, sortType Sort) {
+	sort.SliceStable(results, func(a, b int) bool {
+		switch sortType {
+		case SortSeeders:
+			return results[a].Seeders > results[b].Seeders
+		case SortSize:
+			return results[a].Size > results[b].Size
+		case SortLeechers:
+			return results[a].Leechers > results[b].Leechers
+		case SortCompleted:
+			return results[a].Completed > results[b].Completed
+		default:
+			return results[a].Date.After(results[b].Date)
+		}
+	})
 }
 
 func InitClientAndRateLimit(config *config.Config) (*rate.Limiter, *http.Client, error) {
@@ -76,6 +180,75 @@ func InitClientAndRateLimit(config *config.Config) (*rate.Limiter, *http.Client,
 	return rl, client, nil
 }
 
+const DateLayout = "2006-01-02 15:04"
+
+var sizeUnits = map[string]float64{
+	"B":   1,
+	"KB":  1000,
+	"MB":  1000 * 1000,
+	"GB":  1000 * 1000 * 1000,
+	"TB":  1000 * 1000 * 1000 * 1000,
+	"KIB": 1 << 10,
+	"MIB": 1 << 20,
+	"GIB": 1 << 30,
+	"TIB": 1 << 40,
+}
+
+// ParseSize Parses human-readable sizes like "1.3 GiB" into bytes
+func ParseSize(size string) (uint64, error) {
+	fields := strings.Fields(size)
+	if len(fields) != 2 {
+		return 0, fmt.Errorf("invalid size: %s", size)
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size value: %w", err)
+	}
+
+	multiplier, exists := sizeUnits[strings.ToUpper(fields[1])]
+	if !exists {
+		return 0, fmt.Errorf("invalid size unit: %s", fields[1])
+	}
+
+	return uint64(value * multiplier), nil
+}
+
+// ParseDate Parses dates like "2023-03-25 18:00", which are always in UTC
+func ParseDate(date string) (time.Time, error) {
+	return time.ParseInLocation(DateLayout, date, time.UTC)
+}
+
+// BuildFeedUrl Returns feed's custom url (or defaultUrl if it has none) with feed params applied
+func BuildFeedUrl(defaultUrl string, feed Feed) (string, error) {
+	feedUrl := defaultUrl
+	if feed.Url != "" {
+		feedUrl = feed.Url
+	}
+
+	parsed, err := url.Parse(feedUrl)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse feed url: %w", err)
+	}
+
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", fmt.Errorf("invalid feed url scheme: %s", parsed.Scheme)
+	}
+
+	if len(feed.Params) == 0 {
+		return feedUrl, nil
+	}
+
+	urlQuery := parsed.Query()
+	for key, value := range feed.Params {
+		urlQuery.Set(key, value)
+	}
+	parsed.RawQuery = urlQuery.Encode()
+
+	return parsed.String(), nil
+}
+
+// DownloadFile Returns response body, non-200 responses are errors, so that error pages are never used as files
 func DownloadFile(ctx context.Context, client *http.Client, rl *rate.Limiter, req *http.Request) ([]byte, error) {
 	if err := rl.Wait(ctx); err != nil {
 		return nil, fmt.Errorf("download cancelled: %w", err)
@@ -88,6 +261,10 @@ func DownloadFile(ctx context.Context, client *http.Client, rl *rate.Limiter, re
 
 	defer res.Body.Close()
 
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got invalid status code: %d", res.StatusCode)
+	}
+
 	bodyBytes, err := io.ReadAll(res.Body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response: %w", err)
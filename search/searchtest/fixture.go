@@ -0,0 +1,109 @@
+// Package searchtest Replays recorded provider responses, so that search providers can be tested offline
+package searchtest
+
+import (
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// BasePlaceholder Is replaced with the server url in served fixtures
+const BasePlaceholder = "{{BASE}}"
+
+// FixtureServer Serves fixtures from the testdata dir, unknown paths fail the test
+type FixtureServer struct {
+	*httptest.Server
+	t        *testing.T
+	dir      string
+	mutex    sync.Mutex
+	handlers map[string]http.HandlerFunc
+	requests []*http.Request
+}
+
+func NewFixtureServer(t *testing.T) *FixtureServer {
+	return NewFixtureServerAt(t, "testdata")
+}
+
+// NewFixtureServerAt Serves fixtures from the given dir, e.g. to reuse fixtures of a provider outside its package
+func NewFixtureServerAt(t *testing.T, dir string) *FixtureServer {
+	server := &FixtureServer{
+		t:        t,
+		dir:      dir,
+		handlers: make(map[string]http.HandlerFunc),
+	}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serveHTTP))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *FixtureServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	s.requests = append(s.requests, r)
+	handler, exists := s.handlers[r.URL.Path]
+	s.mutex.Unlock()
+
+	if !exists {
+		s.t.Errorf("unexpected request: %s", r.URL.String())
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	handler(w, r)
+}
+
+// Handle Registers custom handler for the path
+func (s *FixtureServer) Handle(path string, handler http.HandlerFunc) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.handlers[path] = handler
+}
+
+// Serve Registers fixture file for the path
+func (s *FixtureServer) Serve(path string, fixture string, contentType string) {
+	s.Handle(path, func(w http.ResponseWriter, r *http.Request) {
+		s.WriteFixture(w, fixture, contentType)
+	})
+}
+
+func (s *FixtureServer) WriteFixture(w http.ResponseWriter, fixture string, contentType string) {
+	data, err := os.ReadFile(filepath.Join(s.dir, fixture))
+	require.Nil(s.t, err)
+	w.Header().Set("Content-Type", contentType)
+	_, _ = w.Write([]byte(strings.ReplaceAll(string(data), BasePlaceholder, s.URL)))
+}
+
+// Requests Returns all requests received so far
+func (s *FixtureServer) Requests() []*http.Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]*http.Request(nil), s.requests...)
+}
+
+// GenTorrentBytes Builds a .torrent file with the given files, info hash depends only on name and files
+func GenTorrentBytes(t *testing.T, name string, fileNames ...string) []byte {
+	info := metainfo.Info{
+		Name:        name,
+		PieceLength: 16384,
+		Pieces:      make([]byte, 20),
+	}
+	for _, fileName := range fileNames {
+		info.Files = append(info.Files, metainfo.FileInfo{
+			Path:   []string{fileName},
+			Length: 1024,
+		})
+	}
+	infoBytes, err := bencode.Marshal(info)
+	require.Nil(t, err)
+	torrentBytes, err := bencode.Marshal(metainfo.MetaInfo{
+		InfoBytes: infoBytes,
+	})
+	require.Nil(t, err)
+	return torrentBytes
+}
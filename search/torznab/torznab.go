@@ -0,0 +1,405 @@
+package torznab
+
+import (
+	"anileha/config"
+	"anileha/search"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/elliotchance/pie/v2"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ProviderName = "torznab"
+
+// apiKeyPlaceholder Replaces api key in download urls encoded into item ids, since ids are stored in db
+const apiKeyPlaceholder = "{apikey}"
+
+type Service struct {
+	config      *config.Config
+	log         *zap.Logger
+	rateLimiter *rate.Limiter
+	client      *http.Client
+}
+
+var _ search.Provider = (*Service)(nil)
+
+type feed struct {
+	XMLName xml.Name `xml:"rss"`
+	Channel struct {
+		Items []item `xml:"item"`
+	} `xml:"channel"`
+}
+
+type feedError struct {
+	XMLName     xml.Name `xml:"error"`
+	Code        int      `xml:"code,attr"`
+	Description string   `xml:"description,attr"`
+}
+
+type item struct {
+	Title     string `xml:"title"`
+	Guid      string `xml:"guid"`
+	Link      string `xml:"link"`
+	Comments  string `xml:"comments"`
+	PubDate   string `xml:"pubDate"`
+	Size      int64  `xml:"size"`
+	Enclosure struct {
+		Url string `xml:"url,attr"`
+	} `xml:"enclosure"`
+	Attrs []struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:"value,attr"`
+	} `xml:"http://torznab.com/schemas/2015/feed attr"`
+}
+
+func (i *item) attr(name string) string {
+	for _, a := range i.Attrs {
+		if a.Name == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// leechers Torznab reports peers, which include seeders
+func (i *item) leechers() int {
+	seeders, _ := strconv.Atoi(i.attr("seeders"))
+	peers, _ := strconv.Atoi(i.attr("peers"))
+	if peers < seeders {
+		return 0
+	}
+	return peers - seeders
+}
+
+func (i *item) downloadUrl() string {
+	if i.Enclosure.Url != "" {
+		return i.Enclosure.Url
+	}
+	return i.Link
+}
+
+func (i *item) viewUrl() string {
+	if i.Comments != "" {
+		return i.Comments
+	}
+	return i.Guid
+}
+
+func (i *item) timestamp() *time.Time {
+	parsed, err := time.Parse(time.RFC1123Z, i.PubDate)
+	if err != nil {
+		parsed, err = time.Parse(time.RFC1123, i.PubDate)
+		if err != nil {
+			return nil
+		}
+	}
+	return &parsed
+}
+
+func NewService(
+	config *config.Config,
+	log *zap.Logger,
+) (*Service, error) {
+	if _, err := url.Parse(config.Search.Torznab.BaseUrl); err != nil {
+		return nil, fmt.Errorf("failed to parse torznab base url: %w", err)
+	}
+
+	rl, client, err := search.InitClientAndRateLimit(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Service{
+		log:         log,
+		config:      config,
+		rateLimiter: rl,
+		client:      client,
+	}, nil
+}
+
+func (s *Service) Name() string {
+	return ProviderName
+}
+
+func (s *Service) Search(ctx context.Context, query search.Query) ([]search.Result, error) {
+	req, err := s.genRequest(ctx, query.Query, query.Page, query.Category)
+	if err != nil {
+		return nil, fmt.Errorf("error generating request: %w", err)
+	}
+
+	items, err := s.loadItems(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load items: %w", err)
+	}
+
+	results := make([]search.Result, 0, len(items))
+
+	for _, i := range items {
+		var date time.Time
+		if timestamp := i.timestamp(); timestamp != nil {
+			date = timestamp.UTC()
+		}
+		seeders, _ := strconv.Atoi(i.attr("seeders"))
+		completed, _ := strconv.Atoi(i.attr("grabs"))
+
+		results = append(results, search.Result{
+			ID:        s.itemId(i),
+			Title:     i.Title,
+			Seeders:   seeders,
+			Leechers:  i.leechers(),
+			Completed: completed,
+			Size:      uint64(i.Size),
+			Date:      date,
+			Category:  i.attr("category"),
+			InfoHash:  strings.ToLower(i.attr("infohash")),
+			Link:      i.viewUrl(),
+		})
+	}
+
+	search.SortResults(results, query.SortType)
+
+	return results, nil
+}
+
+// RSSUrl Api key is not included, since url is stored in db, params are added to the t=search request.
+// Torznab has no site filters, so feed.Filter is ignored
+func (s *Service) RSSUrl(feed search.Feed) (string, error) {
+	if err := validateCategory(feed.Category); err != nil {
+		return "", err
+	}
+	return search.BuildFeedUrl(s.apiUrl()+"?"+s.searchParams("", 0, feed.Category).Encode(), feed)
+}
+
+// validateCategory Custom category is a comma separated list of torznab category ids, e.g. 5070,5000
+func validateCategory(category string) error {
+	if category == "" {
+		return nil
+	}
+	for _, id := range strings.Split(category, ",") {
+		if _, err := strconv.Atoi(strings.TrimSpace(id)); err != nil {
+			return fmt.Errorf("invalid torznab category: %s", category)
+		}
+	}
+	return nil
+}
+
+func (s *Service) GetRSS(ctx context.Context, feed search.Feed) ([]search.ResultRSS, error) {
+	feedUrl, err := s.RSSUrl(feed)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := s.genFeedRequest(ctx, feedUrl)
+	if err != nil {
+		return nil, fmt.Errorf("error generating request: %w", err)
+	}
+
+	items, err := s.loadItems(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load rss: %w", err)
+	}
+
+	results := make([]search.ResultRSS, 0, len(items))
+
+	for _, i := range items {
+		seeders, _ := strconv.Atoi(i.attr("seeders"))
+
+		results = append(results, search.ResultRSS{
+			ID:        s.itemId(i),
+			Title:     i.Title,
+			Link:      i.viewUrl(),
+			Timestamp: i.timestamp(),
+			Size:      uint64(i.Size),
+			Seeders:   seeders,
+			InfoHash:  strings.ToLower(i.attr("infohash")),
+		})
+	}
+
+	return results, nil
+}
+
+// itemId Torznab has no way to look items up, so download url is encoded into id,
+// which keeps ids valid across restarts
+func (s *Service) itemId(i item) string {
+	downloadUrl := i.downloadUrl()
+	if apiKey := s.config.Search.Torznab.ApiKey; apiKey != "" {
+		downloadUrl = strings.ReplaceAll(downloadUrl, url.QueryEscape(apiKey), apiKeyPlaceholder)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(downloadUrl))
+}
+
+// parseId Returns download url encoded into id by itemId
+func (s *Service) parseId(id string) (string, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil || len(decoded) == 0 {
+		return "", fmt.Errorf("invalid torznab item id: %s", id)
+	}
+	return strings.ReplaceAll(string(decoded), apiKeyPlaceholder, url.QueryEscape(s.config.Search.Torznab.ApiKey)), nil
+}
+
+func (s *Service) DownloadById(ctx context.Context, id string) ([]byte, error) {
+	downloadUrl, err := s.parseId(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(downloadUrl, "magnet:") {
+		return nil, fmt.Errorf("torznab item %s only has a magnet link", id)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", downloadUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download request: %w", err)
+	}
+
+	torrentBytes, err := search.DownloadFile(ctx, s.client, s.rateLimiter, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+
+	return torrentBytes, nil
+}
+
+// GetById Torznab has no details endpoint, so file list is read from the .torrent file itself
+func (s *Service) GetById(ctx context.Context, id string) (search.ResultById, error) {
+	downloadUrl, err := s.parseId(id)
+	if err != nil {
+		return search.ResultById{}, err
+	}
+
+	torrentBytes, err := s.DownloadById(ctx, id)
+	if err != nil {
+		return search.ResultById{}, err
+	}
+
+	metaInfo, err := metainfo.Load(bytes.NewReader(torrentBytes))
+	if err != nil {
+		return search.ResultById{}, fmt.Errorf("failed to parse torrent file: %w", err)
+	}
+
+	info, err := metaInfo.UnmarshalInfo()
+	if err != nil {
+		return search.ResultById{}, fmt.Errorf("failed to parse torrent info: %w", err)
+	}
+
+	files := pie.Map(info.UpvertedFiles(), func(file metainfo.FileInfo) string {
+		return file.DisplayPath(&info)
+	})
+
+	return search.ResultById{
+		DownloadUrl: downloadUrl,
+		Files:       files,
+	}, nil
+}
+
+// loadItems Performs api request
+func (s *Service) loadItems(ctx context.Context, req *http.Request) ([]item, error) {
+	body, err := search.DownloadFile(ctx, s.client, s.rateLimiter, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var errorResponse feedError
+	if xml.Unmarshal(body, &errorResponse) == nil {
+		return nil, fmt.Errorf("torznab error %d: %s", errorResponse.Code, errorResponse.Description)
+	}
+
+	var response feed
+	if err := xml.Unmarshal(body, &response); err != nil {
+		s.log.Error("failed to parse torznab response",
+			zap.String("body", string(body)),
+			zap.Error(err))
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return response.Channel.Items, nil
+}
+
+// searchParams Returns t=search params without api key, an empty query returns latest items, which works as RSS.
+// Empty category means configured categories
+func (s *Service) searchParams(query string, page int, category string) url.Values {
+	torznabConfig := s.config.Search.Torznab
+
+	urlQuery := make(url.Values)
+	urlQuery.Set("t", "search")
+	urlQuery.Set("limit", strconv.Itoa(torznabConfig.Limit))
+	urlQuery.Set("offset", strconv.Itoa(page*torznabConfig.Limit))
+
+	if query != "" {
+		urlQuery.Set("q", query)
+	}
+
+	if category != "" {
+		urlQuery.Set("cat", strings.ReplaceAll(category, " ", ""))
+	} else if len(torznabConfig.Categories) > 0 {
+		urlQuery.Set("cat", strings.Join(pie.Map(torznabConfig.Categories, strconv.Itoa), ","))
+	}
+
+	return urlQuery
+}
+
+func (s *Service) genRequest(ctx context.Context, query string, page int, category string) (*http.Request, error) {
+	if err := validateCategory(category); err != nil {
+		return nil, err
+	}
+	return s.genFeedRequest(ctx, s.apiUrl()+"?"+s.searchParams(query, page, category).Encode())
+}
+
+// genFeedRequest Adds api key to the given url, unless it already has one.
+// Custom feed urls may point to other sites, so key is only added to urls of the configured indexer
+func (s *Service) genFeedRequest(ctx context.Context, feedUrl string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", feedUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.isIndexerUrl(req.URL) {
+		return req, nil
+	}
+
+	urlQuery := req.URL.Query()
+	if urlQuery.Get("apikey") == "" {
+		urlQuery.Set("apikey", s.config.Search.Torznab.ApiKey)
+	}
+	req.URL.RawQuery = urlQuery.Encode()
+
+	return req, nil
+}
+
+// isIndexerUrl Checks that url has the same scheme and host as the configured base url
+func (s *Service) isIndexerUrl(u *url.URL) bool {
+	baseUrl, err := url.Parse(s.config.Search.Torznab.BaseUrl)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Scheme, baseUrl.Scheme) && strings.EqualFold(u.Host, baseUrl.Host)
+}
+
+func (s *Service) apiUrl() string {
+	return strings.TrimSuffix(s.config.Search.Torznab.BaseUrl, "/") + "/api"
+}
+
+// newProviders Registers torznab provider only if base url is configured
+func newProviders(config *config.Config, log *zap.Logger) ([]search.Provider, error) {
+	if config.Search.Torznab.BaseUrl == "" {
+		return nil, nil
+	}
+	service, err := NewService(config, log)
+	if err != nil {
+		return nil, err
+	}
+	return []search.Provider{service}, nil
+}
+
+var Export = fx.Options(fx.Provide(fx.Annotate(newProviders, fx.ResultTags(`group:"providers,flatten"`))))
@@ -0,0 +1,210 @@
+package torznab
+
+import (
+	"anileha/config"
+	"anileha/search"
+	"anileha/search/searchtest"
+	"context"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const testApiKey = "secret"
+
+func newTestService(t *testing.T) *Service {
+	server := searchtest.NewFixtureServer(t)
+
+	server.Handle("/api", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		assert.Equal(t, "search", query.Get("t"))
+		assert.Contains(t, []string{"5070", "5070,5000"}, query.Get("cat"))
+		if query.Get("apikey") != testApiKey {
+			server.WriteFixture(w, "error.xml", "application/rss+xml")
+		} else if query.Get("q") == "" {
+			server.WriteFixture(w, "rss.xml", "application/rss+xml")
+		} else {
+			server.WriteFixture(w, "search.xml", "application/rss+xml")
+		}
+	})
+	server.Handle("/dl/nyaasi/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(searchtest.GenTorrentBytes(t, "test", r.URL.Query().Get("file")+".mkv"))
+	})
+
+	cfg := config.GetDefaultConfig()
+	cfg.Search.RateLimit.IntervalMs = 1
+	cfg.Search.Torznab.BaseUrl = server.URL
+	cfg.Search.Torznab.ApiKey = testApiKey
+
+	service, err := NewService(&cfg, zap.NewNop())
+	require.Nil(t, err)
+
+	return service
+}
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+
+	res, err := service.Search(ctx, search.Query{
+		Query:    "blue lock erai 1080",
+		SortType: search.SortSeeders,
+	})
+	require.Nil(t, err)
+	require.Equal(t, 2, len(res))
+
+	first := res[0]
+
+	assert.NotEmpty(t, first.ID)
+	assert.Equal(t, "[Erai-raws] Blue Lock - 24 END [1080p][Multiple Subtitle]", first.Title)
+	assert.Equal(t, 456, first.Seeders)
+	assert.Equal(t, 14, first.Leechers)
+	assert.Equal(t, uint64(1395864371), first.Size)
+	assert.Equal(t, int64(1679767200), first.Date.Unix())
+	assert.Equal(t, "5070", first.Category)
+	assert.Equal(t, "8e2b6f1d7c3a4e5f9a0b1c2d3e4f5a6b7c8d9e0f", first.InfoHash)
+	assert.Equal(t, "https://nyaa.si/view/1653158", first.Link)
+}
+
+func TestGetRSS(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+
+	feed, err := service.GetRSS(ctx, search.Feed{})
+	require.Nil(t, err)
+	require.Equal(t, 2, len(feed))
+
+	assert.NotEmpty(t, feed[0].ID)
+	assert.NotEqual(t, feed[0].ID, feed[1].ID)
+	assert.Equal(t, "[SubsPlease] Jigokuraku - 01 (1080p) [A1B2C3D4].mkv", feed[0].Title)
+	require.NotNil(t, feed[0].Timestamp)
+	assert.Equal(t, int64(1680363067), feed[0].Timestamp.Unix())
+}
+
+func TestGetRSSCustomFeed(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+
+	feed := search.Feed{
+		Params: map[string]string{"q": "blue lock"},
+	}
+
+	feedUrl, err := service.RSSUrl(feed)
+	require.Nil(t, err)
+	assert.NotContains(t, feedUrl, testApiKey)
+	assert.Contains(t, feedUrl, "q=blue+lock")
+
+	results, err := service.GetRSS(ctx, feed)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(results))
+	assert.NotEmpty(t, results[0].ID)
+}
+
+func TestForeignFeedUrlWithoutApiKey(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+
+	foreign := searchtest.NewFixtureServer(t)
+	foreign.Handle("/feed", func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.URL.Query().Get("apikey"))
+		foreign.WriteFixture(w, "rss.xml", "application/rss+xml")
+	})
+
+	req, err := service.genFeedRequest(ctx, service.apiUrl()+"?t=search")
+	require.Nil(t, err)
+	assert.Equal(t, testApiKey, req.URL.Query().Get("apikey"))
+
+	results, err := service.GetRSS(ctx, search.Feed{Url: foreign.URL + "/feed"})
+	require.Nil(t, err)
+	require.Equal(t, 2, len(results))
+}
+
+func TestCustomCategory(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+
+	feedUrl, err := service.RSSUrl(search.Feed{Category: "5070, 5000"})
+	require.Nil(t, err)
+	assert.Contains(t, feedUrl, "cat=5070%2C5000")
+
+	_, err = service.Search(ctx, search.Query{Query: "blue lock", Category: "5070,5000"})
+	require.Nil(t, err)
+
+	_, err = service.RSSUrl(search.Feed{Category: "anime"})
+	require.NotNil(t, err)
+}
+
+func TestDownloadById(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+
+	_, err := service.DownloadById(ctx, "https://nyaa.si/view/1653158")
+	require.NotNil(t, err)
+
+	res, err := service.Search(ctx, search.Query{Query: "blue lock"})
+	require.Nil(t, err)
+
+	torrentBytes, err := service.DownloadById(ctx, res[0].ID)
+	require.Nil(t, err)
+	assert.Equal(t, searchtest.GenTorrentBytes(t, "test", "Blue Lock 24.mkv"), torrentBytes)
+}
+
+func TestIdSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+
+	feed, err := service.GetRSS(ctx, search.Feed{})
+	require.Nil(t, err)
+
+	// ids are stored in db, so they must not contain api key
+	decoded, err := base64.RawURLEncoding.DecodeString(feed[0].ID)
+	require.Nil(t, err)
+	assert.NotContains(t, string(decoded), testApiKey)
+
+	restarted, err := NewService(service.config, zap.NewNop())
+	require.Nil(t, err)
+
+	extra, err := restarted.GetById(ctx, feed[0].ID)
+	require.Nil(t, err)
+	assert.Equal(t, "Jigokuraku 01.mkv", extra.Files[0])
+}
+
+func TestDownloadByIdMagnetOnly(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+
+	feed, err := service.GetRSS(ctx, search.Feed{})
+	require.Nil(t, err)
+
+	_, err = service.DownloadById(ctx, feed[1].ID)
+	require.NotNil(t, err)
+}
+
+func TestGetById(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+
+	feed, err := service.GetRSS(ctx, search.Feed{})
+	require.Nil(t, err)
+
+	extra, err := service.GetById(ctx, feed[0].ID)
+	require.Nil(t, err)
+
+	assert.True(t, strings.HasSuffix(extra.DownloadUrl, "/dl/nyaasi/?jackett_apikey=secret&path=1654001&file=Jigokuraku+01"))
+	require.Equal(t, 1, len(extra.Files))
+	assert.Equal(t, "Jigokuraku 01.mkv", extra.Files[0])
+}
+
+func TestInvalidApiKey(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+	service.config.Search.Torznab.ApiKey = "invalid"
+
+	_, err := service.GetRSS(ctx, search.Feed{})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Invalid API Key")
+}
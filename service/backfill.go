@@ -0,0 +1,422 @@
+package service
+
+import (
+	"anileha/config"
+	"anileha/db"
+	"anileha/rest/engine"
+	"anileha/search"
+	"anileha/util/meta"
+	"context"
+	"fmt"
+	"github.com/elliotchance/pie/v2"
+	goCache "github.com/patrickmn/go-cache"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type BackfillStatus string
+
+const (
+	BackfillSearching BackfillStatus = "searching"
+	BackfillPreview   BackfillStatus = "preview"
+	BackfillAdding    BackfillStatus = "adding"
+	BackfillReady     BackfillStatus = "ready"
+	BackfillError     BackfillStatus = "error"
+)
+
+// BackfillParams Limits of the historical search, zero values mean no limit (except for MaxPages)
+type BackfillParams struct {
+	SeriesId       uint
+	Query          db.SeriesQuery
+	MaxPages       int
+	Since          *time.Time
+	MaxSize        uint64
+	DedupeEpisodes bool
+}
+
+type BackfillItem struct {
+	ID      string
+	Title   string
+	Link    string
+	Size    uint64
+	Date    time.Time
+	Release meta.ReleaseInfo
+	Added   bool
+	Error   string
+}
+
+// BackfillJob Snapshot of backfill job state
+type BackfillJob struct {
+	ID       uint
+	SeriesId uint
+	Provider string
+	Status   BackfillStatus
+	Progress int
+	Error    string
+	Items    []BackfillItem
+}
+
+type backfillJob struct {
+	mutex    sync.Mutex
+	params   BackfillParams
+	provider search.Provider
+	matcher  *queryMatcher
+	cancel   context.CancelFunc
+	state    BackfillJob
+}
+
+func (j *backfillJob) update(f func(state *BackfillJob)) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	f(&j.state)
+}
+
+func (j *backfillJob) snapshot() BackfillJob {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	state := j.state
+	state.Items = append([]BackfillItem(nil), j.state.Items...)
+	return state
+}
+
+// BackfillService Searches for old releases in background, found releases are added only after confirmation
+type BackfillService struct {
+	searchService    *SearchService
+	providerRegistry *search.Registry
+	log              *zap.Logger
+	config           *config.Config
+
+	jobCtx    context.Context
+	jobCancel context.CancelFunc
+	jobWg     sync.WaitGroup
+	jobs      *goCache.Cache // jobs Stores jobs by their id [string -> *backfillJob]
+	idMutex   sync.Mutex
+	lastId    uint
+}
+
+func NewBackfillService(
+	searchService *SearchService,
+	providerRegistry *search.Registry,
+	log *zap.Logger,
+	config *config.Config,
+) *BackfillService {
+	jobCtx, jobCancel := context.WithCancel(context.Background())
+
+	return &BackfillService{
+		searchService:    searchService,
+		providerRegistry: providerRegistry,
+		log:              log,
+		config:           config,
+		jobCtx:           jobCtx,
+		jobCancel:        jobCancel,
+		jobs:             goCache.New(24*time.Hour, time.Hour),
+	}
+}
+
+func (s *BackfillService) nextId() uint {
+	s.idMutex.Lock()
+	defer s.idMutex.Unlock()
+	s.lastId++
+	return s.lastId
+}
+
+func (s *BackfillService) getJob(id uint) (*backfillJob, error) {
+	job, exists := s.jobs.Get(strconv.FormatUint(uint64(id), 10))
+	if !exists {
+		return nil, engine.ErrNotFoundInst
+	}
+	return job.(*backfillJob), nil
+}
+
+// Start Validates params and starts searching, returns job id
+func (s *BackfillService) Start(params BackfillParams) (uint, error) {
+	provider, err := s.providerRegistry.Get(params.Query.Provider)
+	if err != nil {
+		return 0, engine.ErrBadRequest(err.Error())
+	}
+
+	matcher, err := newQueryMatcher(&params.Query)
+	if err != nil {
+		return 0, engine.ErrBadRequest(err.Error())
+	}
+
+	// validates provider specific category and filter
+	if _, err := provider.RSSUrl(queryFeed(&params.Query)); err != nil {
+		return 0, engine.ErrBadRequest(err.Error())
+	}
+
+	if params.MaxPages <= 0 || params.MaxPages > s.config.Search.BackfillMaxPages {
+		params.MaxPages = s.config.Search.BackfillMaxPages
+	}
+
+	ctx, cancel := context.WithCancel(s.jobCtx)
+
+	job := &backfillJob{
+		params:   params,
+		provider: provider,
+		matcher:  matcher,
+		cancel:   cancel,
+		state: BackfillJob{
+			ID:       s.nextId(),
+			SeriesId: params.SeriesId,
+			Provider: provider.Name(),
+			Status:   BackfillSearching,
+		},
+	}
+
+	s.jobs.SetDefault(strconv.FormatUint(uint64(job.state.ID), 10), job)
+
+	s.jobWg.Add(1)
+	go func() {
+		defer s.jobWg.Done()
+		s.search(ctx, job)
+	}()
+
+	s.log.Info("started backfill",
+		zap.Uint("backfillId", job.state.ID),
+		zap.Uint("seriesId", params.SeriesId),
+		zap.Int("maxPages", params.MaxPages))
+
+	return job.state.ID, nil
+}
+
+func (s *BackfillService) Get(id uint) (BackfillJob, error) {
+	job, err := s.getJob(id)
+	if err != nil {
+		return BackfillJob{}, err
+	}
+	return job.snapshot(), nil
+}
+
+// Confirm Adds previewed items in background, all items are added if ids are empty
+func (s *BackfillService) Confirm(id uint, ids []string) error {
+	job, err := s.getJob(id)
+	if err != nil {
+		return err
+	}
+
+	var selected []BackfillItem
+
+	job.mutex.Lock()
+	if job.state.Status != BackfillPreview {
+		job.mutex.Unlock()
+		return engine.ErrBadRequest(fmt.Sprintf("backfill is not in preview state: %s", job.state.Status))
+	}
+	ctx, cancel := context.WithCancel(s.jobCtx)
+	job.cancel = cancel
+	if len(ids) == 0 {
+		selected = job.state.Items
+	} else {
+		selected = pie.Filter(job.state.Items, func(item BackfillItem) bool {
+			return pie.Contains(ids, item.ID)
+		})
+	}
+	job.state.Items = selected
+	job.state.Status = BackfillAdding
+	job.state.Progress = 0
+	job.mutex.Unlock()
+
+	s.jobWg.Add(1)
+	go func() {
+		defer s.jobWg.Done()
+		s.add(ctx, job)
+	}()
+
+	return nil
+}
+
+// Cancel Stops job and forgets about it, items that were already added are kept
+func (s *BackfillService) Cancel(id uint) error {
+	job, err := s.getJob(id)
+	if err != nil {
+		return err
+	}
+	job.mutex.Lock()
+	job.cancel()
+	job.mutex.Unlock()
+	s.jobs.Delete(strconv.FormatUint(uint64(id), 10))
+	return nil
+}
+
+func (s *BackfillService) fail(job *backfillJob, err error) {
+	s.log.Error("backfill failed", zap.Uint("backfillId", job.state.ID), zap.Error(err))
+	job.update(func(state *BackfillJob) {
+		state.Status = BackfillError
+		state.Error = err.Error()
+	})
+}
+
+// search Results are sorted by date, so paging stops at the first result older than params.Since
+func (s *BackfillService) search(ctx context.Context, job *backfillJob) {
+	params := job.params
+	items := make([]BackfillItem, 0, 75)
+
+	for page := 0; page < params.MaxPages; page++ {
+		results, err := job.provider.Search(ctx, search.Query{
+			Query:    strings.Join(params.Query.Include, " "),
+			SortType: search.SortDate,
+			Page:     page,
+			Category: params.Query.Category,
+			Filter:   search.SiteFilter(params.Query.SiteFilter),
+		})
+		if err != nil {
+			s.fail(job, fmt.Errorf("failed to search torrents: %w", err))
+			return
+		}
+
+		if len(results) == 0 {
+			break
+		}
+
+		reachedCutoff := false
+
+		for _, result := range results {
+			if params.Since != nil && !result.Date.IsZero() && result.Date.Before(*params.Since) {
+				reachedCutoff = true
+				break
+			}
+
+			if params.MaxSize > 0 && result.Size > params.MaxSize {
+				continue
+			}
+
+			rssResult := result.RSS()
+			matches, err := s.searchService.test(ctx, job.provider, &rssResult, job.matcher.searchMatcher())
+			if err != nil {
+				s.log.Warn("failed to check backfill result, skipping",
+					zap.Uint("backfillId", job.state.ID),
+					zap.String("id", result.ID),
+					zap.String("title", result.Title),
+					zap.Error(err))
+				continue
+			}
+			if !matches {
+				continue
+			}
+
+			items = append(items, BackfillItem{
+				ID:      result.ID,
+				Title:   result.Title,
+				Link:    result.Link,
+				Size:    result.Size,
+				Date:    result.Date,
+				Release: meta.ParseRelease(result.Title),
+			})
+		}
+
+		job.update(func(state *BackfillJob) {
+			state.Progress = (page + 1) * 100 / params.MaxPages
+		})
+
+		if reachedCutoff {
+			break
+		}
+	}
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	if params.DedupeEpisodes {
+		items = dedupeBackfillItems(job.matcher, items)
+	}
+
+	job.update(func(state *BackfillJob) {
+		state.Status = BackfillPreview
+		state.Progress = 100
+		// oldest first, so that episodes are added in order
+		state.Items = pie.Reverse(items)
+	})
+
+	s.log.Info("backfill preview is ready",
+		zap.Uint("backfillId", job.state.ID),
+		zap.Int("items", len(items)))
+}
+
+// dedupeBackfillItems Leaves a single release per episode, the best one if query has scoring or the newest otherwise
+func dedupeBackfillItems(matcher *queryMatcher, items []BackfillItem) []BackfillItem {
+	result := make([]BackfillItem, 0, len(items))
+	indexByEpisode := make(map[string]int, len(items))
+
+	for _, item := range items {
+		key := item.Release.EpisodeKey()
+		if key == "" {
+			result = append(result, item)
+			continue
+		}
+
+		index, exists := indexByEpisode[key]
+		if !exists {
+			indexByEpisode[key] = len(result)
+			result = append(result, item)
+			continue
+		}
+
+		if matcher.isBetterRelease(item.Release, result[index].Release) {
+			result[index] = item
+		}
+	}
+
+	return result
+}
+
+func (s *BackfillService) add(ctx context.Context, job *backfillJob) {
+	items := job.snapshot().Items
+	auto := job.params.Query.Auto
+
+	for i, item := range items {
+		if ctx.Err() != nil {
+			return
+		}
+
+		err := s.searchService.onMatch(ctx, job.provider, job.params.SeriesId, auto, releaseCandidate{
+			result: search.ResultRSS{
+				ID:    item.ID,
+				Title: item.Title,
+				Link:  item.Link,
+			},
+			release: item.Release,
+		})
+		if err != nil {
+			s.log.Error("failed to add backfill item",
+				zap.Uint("backfillId", job.state.ID),
+				zap.String("id", item.ID),
+				zap.String("title", item.Title),
+				zap.Error(err))
+		}
+
+		job.update(func(state *BackfillJob) {
+			if err != nil {
+				state.Items[i].Error = err.Error()
+			} else {
+				state.Items[i].Added = true
+			}
+			state.Progress = (i + 1) * 100 / len(items)
+		})
+	}
+
+	job.update(func(state *BackfillJob) {
+		state.Status = BackfillReady
+		state.Progress = 100
+	})
+
+	s.log.Info("backfill finished", zap.Uint("backfillId", job.state.ID))
+}
+
+func stopBackfillJobs(lifecycle fx.Lifecycle, backfillService *BackfillService) {
+	lifecycle.Append(
+		fx.Hook{
+			OnStop: func(_ context.Context) error {
+				backfillService.jobCancel()
+				backfillService.jobWg.Wait()
+				return nil
+			},
+		},
+	)
+}
+
+var BackfillExport = fx.Options(fx.Provide(NewBackfillService), fx.Invoke(stopBackfillJobs))
@@ -0,0 +1,332 @@
+package service
+
+import (
+	"anileha/config"
+	"anileha/db"
+	"anileha/rest/engine"
+	"context"
+	"fmt"
+	torrentLib "github.com/anacrolix/torrent"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	"sync"
+	"time"
+)
+
+const bandwidthCheckInterval = time.Second
+
+// BandwidthLimits Bytes per second, zero means unlimited
+type BandwidthLimits struct {
+	DownloadBps int `json:"downloadBps"`
+	UploadBps   int `json:"uploadBps"`
+}
+
+type BandwidthSource string
+
+const (
+	BandwidthDefault  BandwidthSource = "default"
+	BandwidthSchedule BandwidthSource = "schedule"
+	BandwidthOverride BandwidthSource = "override"
+)
+
+// BandwidthState Client-wide limits that are currently applied and where they came from
+type BandwidthState struct {
+	Limits   BandwidthLimits  `json:"limits"`
+	Source   BandwidthSource  `json:"source"`
+	Override *BandwidthLimits `json:"override"`
+}
+
+// bandwidthWindow Time of day interval in minutes since midnight, intervals with from > to wrap around midnight
+type bandwidthWindow struct {
+	from   int
+	to     int
+	limits BandwidthLimits
+}
+
+func (w bandwidthWindow) contains(now time.Time) bool {
+	minute := now.Hour()*60 + now.Minute()
+	if w.from <= w.to {
+		return minute >= w.from && minute < w.to
+	}
+	return minute >= w.from || minute < w.to
+}
+
+func parseDayMinute(value string) (int, error) {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %s, expected HH:MM", value)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+func parseBandwidthSchedule(schedule []config.BandwidthScheduleConfig) ([]bandwidthWindow, error) {
+	windows := make([]bandwidthWindow, 0, len(schedule))
+	for _, entry := range schedule {
+		from, err := parseDayMinute(entry.From)
+		if err != nil {
+			return nil, err
+		}
+		to, err := parseDayMinute(entry.To)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, bandwidthWindow{
+			from: from,
+			to:   to,
+			limits: BandwidthLimits{
+				DownloadBps: entry.DownloadBpsLimit,
+				UploadBps:   entry.UploadBpsLimit,
+			},
+		})
+	}
+	return windows, nil
+}
+
+// torrentThrottle Leaky bucket of a single torrent, anacrolix has no per-torrent limiters,
+// so data transfer of the torrent is paused while it is over its cap
+type torrentThrottle struct {
+	lastRead      int64
+	lastWritten   int64
+	downloadDebt  float64
+	uploadDebt    float64
+	downloadPause bool
+	uploadPause   bool
+}
+
+// bandwidthController Swaps limits of client-wide limiters in place and throttles capped torrents
+type bandwidthController struct {
+	mutex           sync.Mutex
+	downloadLimiter *rate.Limiter
+	uploadLimiter   *rate.Limiter
+	defaults        BandwidthLimits
+	schedule        []bandwidthWindow
+	override        *BandwidthLimits
+	applied         BandwidthLimits
+	torrentCaps     map[uint]BandwidthLimits
+	throttles       map[uint]*torrentThrottle
+	downloadsPaused bool // downloadsPaused data download of all torrents is paused, e.g. while free space is low
+}
+
+func newBandwidthController(config *config.Config) (*bandwidthController, error) {
+	schedule, err := parseBandwidthSchedule(config.Data.BandwidthSchedule)
+	if err != nil {
+		return nil, err
+	}
+	defaults := BandwidthLimits{
+		DownloadBps: config.Data.DownloadBpsLimit,
+		UploadBps:   config.Data.UploadBpsLimit,
+	}
+	controller := &bandwidthController{
+		downloadLimiter: rate.NewLimiter(bpsLimit(defaults.DownloadBps), bpsBurst(defaults.DownloadBps)),
+		uploadLimiter:   rate.NewLimiter(bpsLimit(defaults.UploadBps), bpsBurst(defaults.UploadBps)),
+		defaults:        defaults,
+		schedule:        schedule,
+		applied:         defaults,
+		torrentCaps:     make(map[uint]BandwidthLimits),
+		throttles:       make(map[uint]*torrentThrottle),
+	}
+	controller.apply(time.Now())
+	return controller, nil
+}
+
+func bpsLimit(bps int) rate.Limit {
+	if bps <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(bps)
+}
+
+// bpsBurst anacrolix uses upload burst as max request chunk length, so it must not be smaller than a chunk
+func bpsBurst(bps int) int {
+	const minBurst = 256 * 1024
+	if bps < minBurst {
+		return minBurst
+	}
+	return bps
+}
+
+// state Override has precedence over schedule, schedule has precedence over config defaults
+func (c *bandwidthController) state(now time.Time) BandwidthState {
+	if c.override != nil {
+		override := *c.override
+		return BandwidthState{Limits: override, Source: BandwidthOverride, Override: &override}
+	}
+	for _, window := range c.schedule {
+		if window.contains(now) {
+			return BandwidthState{Limits: window.limits, Source: BandwidthSchedule}
+		}
+	}
+	return BandwidthState{Limits: c.defaults, Source: BandwidthDefault}
+}
+
+// apply Updates limiters in place, so that the client is not restarted
+func (c *bandwidthController) apply(now time.Time) bool {
+	limits := c.state(now).Limits
+	if limits == c.applied {
+		return false
+	}
+	c.downloadLimiter.SetLimit(bpsLimit(limits.DownloadBps))
+	c.downloadLimiter.SetBurst(bpsBurst(limits.DownloadBps))
+	c.uploadLimiter.SetLimit(bpsLimit(limits.UploadBps))
+	c.uploadLimiter.SetBurst(bpsBurst(limits.UploadBps))
+	c.applied = limits
+	return true
+}
+
+// throttle Pauses data transfer of the torrent while its transferred bytes exceed its cap
+// or while all downloads are paused
+func (c *bandwidthController) throttle(id uint, cTorrent *torrentLib.Torrent, elapsed time.Duration) {
+	caps, capped := c.torrentCaps[id]
+	throttle, exists := c.throttles[id]
+
+	if !capped && !c.downloadsPaused {
+		if exists {
+			cTorrent.AllowDataDownload()
+			cTorrent.AllowDataUpload()
+			delete(c.throttles, id)
+		}
+		return
+	}
+
+	stats := cTorrent.Stats()
+	read := stats.BytesReadData.Int64()
+	written := stats.BytesWrittenData.Int64()
+
+	if !exists {
+		c.throttles[id] = &torrentThrottle{lastRead: read, lastWritten: written}
+		return
+	}
+
+	throttle.downloadDebt, throttle.downloadPause = updateDebt(throttle.downloadDebt,
+		read-throttle.lastRead, caps.DownloadBps, elapsed)
+	throttle.uploadDebt, throttle.uploadPause = updateDebt(throttle.uploadDebt,
+		written-throttle.lastWritten, caps.UploadBps, elapsed)
+	throttle.lastRead = read
+	throttle.lastWritten = written
+
+	if throttle.downloadPause || c.downloadsPaused {
+		cTorrent.DisallowDataDownload()
+	} else {
+		cTorrent.AllowDataDownload()
+	}
+	if throttle.uploadPause {
+		cTorrent.DisallowDataUpload()
+	} else {
+		cTorrent.AllowDataUpload()
+	}
+}
+
+// updateDebt Returns bytes transferred over the cap and whether transfer has to be paused to pay them off
+func updateDebt(debt float64, transferred int64, capBps int, elapsed time.Duration) (float64, bool) {
+	if capBps <= 0 {
+		return 0, false
+	}
+	debt += float64(transferred) - float64(capBps)*elapsed.Seconds()
+	if debt < 0 {
+		debt = 0
+	}
+	return debt, debt > 0
+}
+
+// bandwidthWatcher Follows bandwidth schedule and throttles capped torrents
+func (s *TorrentService) bandwidthWatcher(ctx context.Context) {
+	ticker := time.NewTicker(bandwidthCheckInterval)
+	defer ticker.Stop()
+	lastTick := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			elapsed := now.Sub(lastTick)
+			lastTick = now
+
+			s.bandwidth.mutex.Lock()
+			if s.bandwidth.apply(now) {
+				s.log.Info("applied bandwidth limits",
+					zap.Int("downloadBps", s.bandwidth.applied.DownloadBps),
+					zap.Int("uploadBps", s.bandwidth.applied.UploadBps))
+			}
+			active := make(map[uint]struct{})
+			s.cTorrentMap.Range(func(key, value any) bool {
+				id := key.(uint)
+				active[id] = struct{}{}
+				s.bandwidth.throttle(id, value.(*torrentLib.Torrent), elapsed)
+				return true
+			})
+			for id := range s.bandwidth.throttles {
+				if _, exists := active[id]; !exists {
+					delete(s.bandwidth.throttles, id)
+				}
+			}
+			s.bandwidth.mutex.Unlock()
+		}
+	}
+}
+
+// loadTorrentCaps Restores per-torrent caps from db
+func (s *TorrentService) loadTorrentCaps() error {
+	torrents, err := s.torrentRepo.GetCapped()
+	if err != nil {
+		return err
+	}
+	s.bandwidth.mutex.Lock()
+	defer s.bandwidth.mutex.Unlock()
+	for _, torrent := range torrents {
+		s.bandwidth.torrentCaps[torrent.ID] = torrentBandwidth(torrent)
+	}
+	return nil
+}
+
+func (s *TorrentService) GetBandwidth() BandwidthState {
+	s.bandwidth.mutex.Lock()
+	defer s.bandwidth.mutex.Unlock()
+	return s.bandwidth.state(time.Now())
+}
+
+// SetBandwidthOverride Limits are applied immediately until override is cleared with nil, it is not persisted
+func (s *TorrentService) SetBandwidthOverride(limits *BandwidthLimits) BandwidthState {
+	s.bandwidth.mutex.Lock()
+	defer s.bandwidth.mutex.Unlock()
+	s.bandwidth.override = limits
+	now := time.Now()
+	s.bandwidth.apply(now)
+	state := s.bandwidth.state(now)
+	s.log.Info("bandwidth override changed",
+		zap.String("source", string(state.Source)),
+		zap.Int("downloadBps", state.Limits.DownloadBps),
+		zap.Int("uploadBps", state.Limits.UploadBps))
+	return state
+}
+
+// SetTorrentBandwidth Zero limits remove the cap
+func (s *TorrentService) SetTorrentBandwidth(id uint, limits BandwidthLimits) error {
+	torrent, err := s.torrentRepo.GetById(id, false)
+	if err != nil {
+		return engine.ErrInternal(err.Error())
+	}
+	if torrent == nil {
+		return engine.ErrNotFoundInst
+	}
+	if err := s.torrentRepo.SetBandwidth(id, limits.DownloadBps, limits.UploadBps); err != nil {
+		return engine.ErrInternal(err.Error())
+	}
+
+	s.bandwidth.mutex.Lock()
+	defer s.bandwidth.mutex.Unlock()
+	if limits.DownloadBps > 0 || limits.UploadBps > 0 {
+		s.bandwidth.torrentCaps[id] = limits
+	} else {
+		delete(s.bandwidth.torrentCaps, id)
+	}
+
+	return nil
+}
+
+// torrentBandwidth Returns per-torrent cap, zero values mean no cap
+func torrentBandwidth(torrent db.Torrent) BandwidthLimits {
+	return BandwidthLimits{
+		DownloadBps: torrent.DownloadBpsLimit,
+		UploadBps:   torrent.UploadBpsLimit,
+	}
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"anileha/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func dayTime(hour int, minute int) time.Time {
+	return time.Date(2023, 4, 1, hour, minute, 0, 0, time.Local)
+}
+
+func TestBandwidthSchedule(t *testing.T) {
+	cfg := config.GetDefaultConfig()
+	cfg.Data.BandwidthSchedule = []config.BandwidthScheduleConfig{
+		{From: "01:00", To: "07:30"},
+		{From: "22:00", To: "00:30", DownloadBpsLimit: 100, UploadBpsLimit: 50},
+	}
+
+	controller, err := newBandwidthController(&cfg)
+	require.Nil(t, err)
+
+	state := controller.state(dayTime(3, 0))
+	assert.Equal(t, BandwidthSchedule, state.Source)
+	assert.Equal(t, BandwidthLimits{}, state.Limits)
+
+	state = controller.state(dayTime(7, 30))
+	assert.Equal(t, BandwidthDefault, state.Source)
+	assert.Equal(t, cfg.Data.DownloadBpsLimit, state.Limits.DownloadBps)
+
+	// window wraps around midnight
+	assert.Equal(t, 100, controller.state(dayTime(23, 0)).Limits.DownloadBps)
+	assert.Equal(t, 50, controller.state(dayTime(0, 15)).Limits.UploadBps)
+	assert.Equal(t, BandwidthDefault, controller.state(dayTime(0, 30)).Source)
+
+	controller.override = &BandwidthLimits{DownloadBps: 10}
+	state = controller.state(dayTime(3, 0))
+	assert.Equal(t, BandwidthOverride, state.Source)
+	assert.Equal(t, 10, state.Limits.DownloadBps)
+}
+
+func TestBandwidthApply(t *testing.T) {
+	cfg := config.GetDefaultConfig()
+	cfg.Data.BandwidthSchedule = []config.BandwidthScheduleConfig{
+		{From: "01:00", To: "07:00"},
+	}
+
+	controller, err := newBandwidthController(&cfg)
+	require.Nil(t, err)
+
+	controller.apply(dayTime(12, 0))
+	assert.Equal(t, bpsLimit(cfg.Data.DownloadBpsLimit), controller.downloadLimiter.Limit())
+
+	// limiters are updated in place, client keeps the same pointers
+	limiter := controller.downloadLimiter
+	assert.True(t, controller.apply(dayTime(2, 0)))
+	assert.Same(t, limiter, controller.downloadLimiter)
+	assert.Equal(t, bpsLimit(0), controller.downloadLimiter.Limit())
+	assert.False(t, controller.apply(dayTime(3, 0)))
+}
+
+func TestInvalidBandwidthSchedule(t *testing.T) {
+	cfg := config.GetDefaultConfig()
+	cfg.Data.BandwidthSchedule = []config.BandwidthScheduleConfig{
+		{From: "1am", To: "07:00"},
+	}
+
+	_, err := newBandwidthController(&cfg)
+	assert.NotNil(t, err)
+}
+
+func TestUpdateDebt(t *testing.T) {
+	debt, pause := updateDebt(0, 3000, 1000, time.Second)
+	assert.Equal(t, float64(2000), debt)
+	assert.True(t, pause)
+
+	debt, pause = updateDebt(debt, 0, 1000, time.Second)
+	assert.True(t, pause)
+
+	debt, pause = updateDebt(debt, 0, 1000, time.Second)
+	assert.Equal(t, float64(0), debt)
+	assert.False(t, pause)
+
+	_, pause = updateDebt(0, 3000, 0, time.Second)
+	assert.False(t, pause)
+}
@@ -18,6 +18,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type ConversionService struct {
@@ -30,6 +31,9 @@ type ConversionService struct {
 	fileService      *FileService
 	seriesService    *SeriesService
 	episodeService   *EpisodeService
+	eventService     *EventService
+	storageService   *StorageService
+	config           *config.Config
 	conversionFolder string
 }
 
@@ -40,6 +44,8 @@ func NewConversionService(
 	fileService *FileService,
 	seriesService *SeriesService,
 	episodeService *EpisodeService,
+	eventService *EventService,
+	storageService *StorageService,
 	log *zap.Logger,
 	config *config.Config,
 ) (*ConversionService, error) {
@@ -68,6 +74,9 @@ func NewConversionService(
 		fileService:      fileService,
 		seriesService:    seriesService,
 		episodeService:   episodeService,
+		eventService:     eventService,
+		storageService:   storageService,
+		config:           config,
 		log:              log,
 		queue:            queue,
 		queueChan:        queueChan,
@@ -154,23 +163,36 @@ func (s *ConversionService) DeleteConversionById(id uint) error {
 	if count == 0 {
 		return engine.ErrDeletionFailed
 	}
+	s.storageService.Release(conversionReservation(id))
+	s.eventService.Publish(EventConversion, ConversionEvent{Id: id, Status: conversion.Status, Deleted: true})
 	go s.cleanUpConversion(*conversion)
 	return nil
 }
 
+// queueWorker Publishes every progress update, but saves progress to db less often
 func (s *ConversionService) queueWorker() {
+	saveInterval := time.Duration(s.config.Data.ProgressDbSaveSec) * time.Second
+	lastSaves := make(map[uint]time.Time)
 	for update := range s.queueChan {
 		switch msg := update.Msg.(type) {
 		case ffmpeg.QueueSignalStarted:
+			lastSaves[update.ID] = time.Now()
 			if err := s.conversionRepo.SetStatus(update.ID, db.ConversionProcessing); err != nil {
 				s.log.Error("failed to update db on conversion start",
 					zap.Uint("conversionId", update.ID),
 					zap.Error(err))
 				continue
 			}
+			s.eventService.PublishConversion(update.ID, db.ConversionProcessing, nil, nil)
 		case string:
 			s.log.Info(msg, zap.Uint("conversionId", update.ID))
 		case util.Progress:
+			progress := msg
+			s.eventService.PublishConversion(update.ID, db.ConversionProcessing, &progress, nil)
+			if time.Since(lastSaves[update.ID]) < saveInterval {
+				continue
+			}
+			lastSaves[update.ID] = time.Now()
 			if err := s.conversionRepo.SetProgress(update.ID, msg); err != nil {
 				s.log.Error("failed to update db on conversion progress",
 					zap.Uint("conversionId", update.ID),
@@ -179,6 +201,8 @@ func (s *ConversionService) queueWorker() {
 			}
 			//s.log.Info("conversion progress", zap.Uint("conversionId", update.ID), zap.Float64("progress", msg.Progress), zap.Float64("eta", msg.Eta), zap.Float64("elapsed", msg.Elapsed))
 		case ffmpeg.CommandSignalEnd:
+			delete(lastSaves, update.ID)
+			s.storageService.Release(conversionReservation(update.ID))
 			if msg.Err == nil {
 				finishedConversionId := update.ID
 				go func() {
@@ -202,6 +226,8 @@ func (s *ConversionService) queueWorker() {
 							zap.Error(err))
 						return
 					}
+					s.eventService.PublishConversion(finishedConversionId, db.ConversionReady,
+						&util.Progress{Progress: 100}, &episode.ID)
 				}()
 			} else {
 				var newStatus db.ConversionStatus
@@ -216,6 +242,7 @@ func (s *ConversionService) queueWorker() {
 						zap.Error(err))
 					continue
 				}
+				s.eventService.PublishConversion(update.ID, newStatus, nil, nil)
 			}
 		}
 	}
@@ -272,8 +299,22 @@ func (s *ConversionService) prepareConversion(
 	return &conversion, nil
 }
 
+// StartConversion Refuses to queue conversions if their estimated output doesn't fit into free space,
+// output of each conversion is estimated by the length of its source file
 func (s *ConversionService) StartConversion(torrent db.Torrent, torrentFiles []db.TorrentFile,
 	prefsArr []command2.Preferences) error {
+	estimate := int64(0)
+	for _, file := range torrentFiles {
+		estimate += int64(file.Length)
+	}
+	fits, err := s.storageService.Fits(estimate)
+	if err != nil {
+		return engine.ErrInternal(err.Error())
+	}
+	if !fits {
+		return engine.ErrNotEnoughSpace
+	}
+
 	for i := range torrentFiles {
 		folder, err := s.fileService.GenFolderPath(s.conversionFolder)
 		if err != nil {
@@ -323,6 +364,9 @@ func (s *ConversionService) StartConversion(torrent db.Torrent, torrentFiles []d
 				"failed to create folder for file %s: %s", *torrentFiles[i].ReadyPath, err.Error()))
 		}
 
+		s.storageService.Reserve(conversionReservation(conversion.ID), int64(torrentFiles[i].Length))
+		s.eventService.PublishConversion(conversion.ID, conversion.Status, nil, nil)
+
 		s.queue.Enqueue(conversion.ID, ffmpegCmd)
 	}
 	return nil
@@ -330,8 +374,15 @@ func (s *ConversionService) StartConversion(torrent db.Torrent, torrentFiles []d
 
 func (s *ConversionService) StopConversion(conversionId uint) error {
 	s.queue.Cancel(conversionId)
+	s.storageService.Release(conversionReservation(conversionId))
+
+	if err := s.conversionRepo.SetStatus(conversionId, db.ConversionCancelled); err != nil {
+		return err
+	}
+
+	s.eventService.PublishConversion(conversionId, db.ConversionCancelled, nil, nil)
 
-	return s.conversionRepo.SetStatus(conversionId, db.ConversionCancelled)
+	return nil
 }
 
 func startQueueWorker(service *ConversionService) {
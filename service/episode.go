@@ -24,6 +24,7 @@ type EpisodeService struct {
 	analyzer      *analyze.ProbeAnalyzer
 	fileService   *FileService
 	thumbService  *ThumbService
+	eventService  *EventService
 	episodeFolder string
 }
 
@@ -33,6 +34,7 @@ func NewEpisodeService(
 	seriesRepo *repo.SeriesRepo,
 	fileService *FileService,
 	thumbService *ThumbService,
+	eventService *EventService,
 	analyzer *analyze.ProbeAnalyzer,
 	log *zap.Logger,
 	config *config.Config,
@@ -52,6 +54,7 @@ func NewEpisodeService(
 		analyzer:      analyzer,
 		fileService:   fileService,
 		thumbService:  thumbService,
+		eventService:  eventService,
 		log:           log,
 		config:        config,
 		episodeFolder: episodeFolder,
@@ -108,6 +111,8 @@ func (s *EpisodeService) CreateFromConversion(conversion *db.Conversion) (*db.Ep
 
 	episode.ID = id
 
+	s.eventService.PublishEpisode(episode, false)
+
 	return &episode, nil
 }
 
@@ -159,6 +164,8 @@ func (s *EpisodeService) CreateManually(seriesId *uint, tempFilePath string, tit
 		_ = s.seriesRepo.MoveToTop(*seriesId)
 	}
 
+	s.eventService.PublishEpisode(episode, false)
+
 	return &episode, nil
 }
 
@@ -241,6 +248,8 @@ func (s *EpisodeService) DeleteById(id uint) error {
 		return engine.ErrNotFoundInst
 	}
 
+	s.eventService.PublishEpisode(*episode, true)
+
 	go s.cleanUpEpisode(*episode)
 	return nil
 }
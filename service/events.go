@@ -0,0 +1,165 @@
+package service
+
+import (
+	"anileha/config"
+	"anileha/db"
+	"anileha/util"
+	"anileha/util/ws"
+	"github.com/gorilla/websocket"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// progressEventInterval Progress of active torrents is published this often
+const progressEventInterval = time.Second
+
+type EventType string
+
+const (
+	EventTorrent      EventType = "torrent"
+	EventTorrentFile  EventType = "torrent-file"
+	EventConversion   EventType = "conversion"
+	EventEpisode      EventType = "episode"
+	EventVerification EventType = "verification"
+)
+
+type TorrentEvent struct {
+	Id            uint             `json:"id"`
+	Status        db.TorrentStatus `json:"status"`
+	Seeding       bool             `json:"seeding"`
+	Progress      util.Progress    `json:"progress"`
+	BytesRead     uint             `json:"bytesRead"`
+	BytesUploaded uint             `json:"bytesUploaded"`
+	Deleted       bool             `json:"deleted"`
+}
+
+type TorrentFileEvent struct {
+	Id             uint                 `json:"id"`
+	TorrentId      uint                 `json:"torrentId"`
+	Status         db.TorrentFileStatus `json:"status"`
+	Selected       bool                 `json:"selected"`
+	BytesCompleted uint                 `json:"bytesCompleted"`
+	Length         uint                 `json:"length"`
+}
+
+type ConversionEvent struct {
+	Id        uint                `json:"id"`
+	Status    db.ConversionStatus `json:"status"`
+	Progress  *util.Progress      `json:"progress"`
+	EpisodeId *uint               `json:"episodeId"`
+	Deleted   bool                `json:"deleted"`
+}
+
+type EpisodeEvent struct {
+	Id       uint   `json:"id"`
+	SeriesId *uint  `json:"seriesId"`
+	Title    string `json:"title"`
+	Deleted  bool   `json:"deleted"`
+}
+
+// EventService Broadcasts state changes and progress to connected admins, events are not persisted
+// and are dropped for clients that can't keep up
+type EventService struct {
+	config  *config.Config
+	log     *zap.Logger
+	mutex   sync.Mutex
+	nextId  uint
+	clients map[uint]*ws.Client
+}
+
+func NewEventService(config *config.Config, log *zap.Logger) *EventService {
+	return &EventService{
+		config:  config,
+		log:     log,
+		clients: make(map[uint]*ws.Client),
+	}
+}
+
+func (s *EventService) Publish(eventType EventType, message any) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	event := MessageStructure[any]{
+		Type:    string(eventType),
+		Message: message,
+	}
+	for _, client := range s.clients {
+		client.Send(event)
+	}
+}
+
+func (s *EventService) PublishTorrent(torrent db.Torrent) {
+	s.Publish(EventTorrent, TorrentEvent{
+		Id:            torrent.ID,
+		Status:        torrent.Status,
+		Seeding:       torrent.Seeding,
+		Progress:      torrent.Progress,
+		BytesRead:     torrent.BytesRead,
+		BytesUploaded: torrent.BytesUploaded,
+	})
+}
+
+// PublishTorrentFiles Files that are downloaded are considered completed
+func (s *EventService) PublishTorrentFiles(torrent db.Torrent) {
+	for _, file := range torrent.Files {
+		bytesCompleted := uint(0)
+		if file.Status == db.TorrentFileAnalysis || file.Status == db.TorrentFileReady {
+			bytesCompleted = file.Length
+		}
+		s.Publish(EventTorrentFile, TorrentFileEvent{
+			Id:             file.ID,
+			TorrentId:      torrent.ID,
+			Status:         file.Status,
+			Selected:       file.Selected,
+			BytesCompleted: bytesCompleted,
+			Length:         file.Length,
+		})
+	}
+}
+
+func (s *EventService) PublishConversion(id uint, status db.ConversionStatus, progress *util.Progress,
+	episodeId *uint) {
+	s.Publish(EventConversion, ConversionEvent{
+		Id:        id,
+		Status:    status,
+		Progress:  progress,
+		EpisodeId: episodeId,
+	})
+}
+
+func (s *EventService) PublishEpisode(episode db.Episode, deleted bool) {
+	s.Publish(EventEpisode, EpisodeEvent{
+		Id:       episode.ID,
+		SeriesId: episode.SeriesId,
+		Title:    episode.Title,
+		Deleted:  deleted,
+	})
+}
+
+// HandleConnection Event stream is one-way, messages from client are ignored
+func (s *EventService) HandleConnection(conn *websocket.Conn, user *db.User) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.nextId++
+	clientId := s.nextId
+
+	receiveListener := func(client *ws.Client, bytes []byte) {}
+
+	disconnectListener := func(client *ws.Client) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		delete(s.clients, clientId)
+		s.log.Info("event stream client disconnected", zap.Uint("userId", user.ID))
+	}
+
+	client := ws.NewClient(clientId, conn, receiveListener, disconnectListener, s.config, s.log)
+	s.clients[clientId] = client
+	client.Start()
+
+	s.log.Info("event stream client connected", zap.Uint("userId", user.ID))
+}
+
+var EventExport = fx.Options(fx.Provide(NewEventService))
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"anileha/db"
+	"anileha/db/repo"
+	"anileha/metadata"
+	"anileha/rest/engine"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/elliotchance/pie/v2"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"time"
+)
+
+// MetadataService Links series to external anime catalogs and stores fetched info on them
+type MetadataService struct {
+	seriesRepo       *repo.SeriesRepo
+	providerRegistry *metadata.Registry
+	log              *zap.Logger
+}
+
+func NewMetadataService(seriesRepo *repo.SeriesRepo, providerRegistry *metadata.Registry,
+	log *zap.Logger) *MetadataService {
+	return &MetadataService{
+		seriesRepo:       seriesRepo,
+		providerRegistry: providerRegistry,
+		log:              log,
+	}
+}
+
+// Link Fetches anime by provider specific id and stores its info on the series
+func (s *MetadataService) Link(ctx context.Context, seriesId uint, providerName string,
+	externalId string) (db.SeriesMetadata, error) {
+	series, err := s.seriesRepo.GetById(seriesId)
+	if err != nil {
+		return db.SeriesMetadata{}, engine.ErrInternal(err.Error())
+	}
+	if series == nil {
+		return db.SeriesMetadata{}, engine.ErrNotFoundInst
+	}
+
+	provider, err := s.providerRegistry.Get(providerName)
+	if err != nil {
+		return db.SeriesMetadata{}, engine.ErrBadRequest(err.Error())
+	}
+
+	return s.update(ctx, series, provider, externalId)
+}
+
+// Refresh Fetches info of the already linked anime again, e.g. to get titles of newly aired episodes
+func (s *MetadataService) Refresh(ctx context.Context, seriesId uint) (db.SeriesMetadata, error) {
+	series, err := s.seriesRepo.GetById(seriesId)
+	if err != nil {
+		return db.SeriesMetadata{}, engine.ErrInternal(err.Error())
+	}
+	if series == nil {
+		return db.SeriesMetadata{}, engine.ErrNotFoundInst
+	}
+	if series.Metadata == nil {
+		return db.SeriesMetadata{}, engine.ErrBadRequest("series is not linked to any anime")
+	}
+
+	linked := series.Metadata.Data()
+
+	provider, err := s.providerRegistry.Get(linked.Provider)
+	if err != nil {
+		return db.SeriesMetadata{}, engine.ErrBadRequest(err.Error())
+	}
+
+	return s.update(ctx, series, provider, linked.ExternalId)
+}
+
+func (s *MetadataService) update(ctx context.Context, series *db.Series, provider metadata.Provider,
+	externalId string) (db.SeriesMetadata, error) {
+	anime, err := provider.GetById(ctx, externalId)
+	if errors.Is(err, metadata.ErrNotFound) {
+		return db.SeriesMetadata{}, engine.ErrBadRequest(err.Error())
+	}
+	if err != nil {
+		return db.SeriesMetadata{}, engine.ErrInternal(fmt.Sprintf("failed to get anime: %s", err.Error()))
+	}
+
+	seriesMetadata := db.SeriesMetadata{
+		Provider:      provider.Name(),
+		ExternalId:    anime.ID,
+		Title:         anime.Title,
+		AltTitles:     anime.AltTitles,
+		Synopsis:      anime.Synopsis,
+		Year:          anime.Year,
+		Season:        anime.Season,
+		Genres:        anime.Genres,
+		TotalEpisodes: anime.Episodes,
+		Poster:        anime.Poster,
+		Episodes: pie.Map(anime.EpisodeTitles, func(episode metadata.EpisodeTitle) db.EpisodeTitle {
+			return db.EpisodeTitle{
+				Episode: episode.Episode,
+				Title:   episode.Title,
+			}
+		}),
+		UpdatedAt: time.Now(),
+	}
+
+	if err := s.seriesRepo.SetMetadata(series.ID, seriesMetadata); err != nil {
+		return db.SeriesMetadata{}, engine.ErrInternal(err.Error())
+	}
+
+	s.log.Info("updated series metadata",
+		zap.Uint("seriesId", series.ID),
+		zap.String("provider", provider.Name()),
+		zap.String("externalId", anime.ID),
+		zap.String("title", anime.Title))
+
+	return seriesMetadata, nil
+}
+
+var MetadataExport = fx.Options(fx.Provide(NewMetadataService))
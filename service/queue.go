@@ -0,0 +1,211 @@
+package service
+
+import (
+	"anileha/db"
+	"anileha/rest/engine"
+	"go.uber.org/zap"
+	"golang.org/x/exp/slices"
+)
+
+// Start Selects files to download and puts torrent into the download queue, nil fileIndices select all files
+func (s *TorrentService) Start(torrent db.Torrent, fileIndices []int) error {
+	if torrent.Local {
+		return engine.ErrBadRequest("local torrent can't be downloaded")
+	}
+
+	// seeded torrent is dropped, its downloaded data is reused
+	s.dropClientTorrent(torrent.ID)
+
+	unselectedFiles := make([]uint, 0, len(torrent.Files))
+	selectedFiles := make([]uint, 0, len(torrent.Files))
+
+	for _, file := range torrent.Files {
+		if fileIndices == nil || slices.Contains(fileIndices, file.ClientIndex) {
+			selectedFiles = append(selectedFiles, file.ID)
+		} else {
+			unselectedFiles = append(unselectedFiles, file.ID)
+		}
+	}
+
+	if len(selectedFiles) == 0 {
+		return engine.ErrBadRequest("no files selected")
+	}
+
+	if err := s.torrentRepo.QueueTorrent(torrent.ID, unselectedFiles, selectedFiles); err != nil {
+		return engine.ErrInternal(err.Error())
+	}
+
+	s.publishTorrent(torrent.ID)
+
+	s.log.Info("torrent queued",
+		zap.Uint("torrentId", torrent.ID),
+		zap.String("torrentName", torrent.Name),
+		zap.Int("fileCount", len(selectedFiles)))
+
+	s.processQueue()
+
+	return nil
+}
+
+// processQueue Starts queued torrents while there are free download slots
+func (s *TorrentService) processQueue() {
+	s.queueMutex.Lock()
+	defer s.queueMutex.Unlock()
+
+	active, err := s.torrentRepo.CountByStatus(db.TorrentDownload)
+	if err != nil {
+		s.log.Error("failed to count active downloads", zap.Error(err))
+		return
+	}
+
+	freeSlots := s.config.Data.MaxDownloads - int(active)
+	if freeSlots <= 0 {
+		return
+	}
+
+	queued, err := s.torrentRepo.GetQueued()
+	if err != nil {
+		s.log.Error("failed to get queued torrents", zap.Error(err))
+		return
+	}
+
+	for _, torrent := range queued {
+		if freeSlots <= 0 {
+			return
+		}
+
+		fileIndices := make([]int, 0, len(torrent.Files))
+		for _, file := range torrent.Files {
+			if file.Selected {
+				fileIndices = append(fileIndices, file.ClientIndex)
+			}
+		}
+
+		if len(fileIndices) == 0 {
+			s.log.Warn("queued torrent has no selected files, stopping it",
+				zap.Uint("torrentId", torrent.ID),
+				zap.String("torrentName", torrent.Name))
+			if err := s.torrentRepo.StopTorrent(torrent.ID); err != nil {
+				s.log.Error("failed to stop torrent",
+					zap.Uint("torrentId", torrent.ID),
+					zap.String("torrentName", torrent.Name),
+					zap.Error(err))
+			}
+			s.publishTorrent(torrent.ID)
+			continue
+		}
+
+		required := requiredSpace(torrent)
+		fits, err := s.storageService.Fits(required)
+		if err != nil {
+			s.log.Error("failed to check free space", zap.Error(err))
+			return
+		}
+		if !fits {
+			// torrent stays queued until space is freed
+			s.log.Debug("not enough free space to start queued torrent",
+				zap.Uint("torrentId", torrent.ID),
+				zap.String("torrentName", torrent.Name),
+				zap.Int64("requiredBytes", required))
+			continue
+		}
+
+		if err := s.startDownload(torrent, fileIndices); err != nil {
+			s.log.Error("failed to start queued torrent",
+				zap.Uint("torrentId", torrent.ID),
+				zap.String("torrentName", torrent.Name),
+				zap.Error(err))
+			if err := s.torrentRepo.StopTorrent(torrent.ID); err != nil {
+				s.log.Error("failed to stop torrent",
+					zap.Uint("torrentId", torrent.ID),
+					zap.String("torrentName", torrent.Name),
+					zap.Error(err))
+			}
+			s.publishTorrent(torrent.ID)
+			continue
+		}
+
+		freeSlots--
+		s.storageService.Reserve(torrentReservation(torrent.ID), required)
+
+		s.log.Info("started queued torrent",
+			zap.Uint("torrentId", torrent.ID),
+			zap.String("torrentName", torrent.Name),
+			zap.Int("priority", torrent.Priority))
+	}
+}
+
+// resumeDownloads Downloads interrupted by restart are queued again with previously selected files
+func (s *TorrentService) resumeDownloads() {
+	if err := s.torrentRepo.RequeueDownloading(); err != nil {
+		s.log.Error("failed to requeue downloading torrents", zap.Error(err))
+		return
+	}
+	s.processQueue()
+}
+
+// GetQueue Returns queued torrents in download order
+func (s *TorrentService) GetQueue() ([]db.Torrent, error) {
+	torrents, err := s.torrentRepo.GetQueued()
+	if err != nil {
+		return nil, engine.ErrInternal(err.Error())
+	}
+	return torrents, nil
+}
+
+// SetPriority Higher priority torrents are started first, already downloading torrents are not affected
+func (s *TorrentService) SetPriority(id uint, priority int) error {
+	torrent, err := s.torrentRepo.GetById(id, false)
+	if err != nil {
+		return engine.ErrInternal(err.Error())
+	}
+	if torrent == nil {
+		return engine.ErrNotFoundInst
+	}
+	if err := s.torrentRepo.SetPriority(id, priority); err != nil {
+		return engine.ErrInternal(err.Error())
+	}
+	return nil
+}
+
+// MoveInQueue Moves queued torrent to the given position among torrents with the same priority
+func (s *TorrentService) MoveInQueue(id uint, position int) error {
+	s.queueMutex.Lock()
+	defer s.queueMutex.Unlock()
+
+	queued, err := s.torrentRepo.GetQueued()
+	if err != nil {
+		return engine.ErrInternal(err.Error())
+	}
+
+	index := slices.IndexFunc(queued, func(torrent db.Torrent) bool {
+		return torrent.ID == id
+	})
+	if index < 0 {
+		return engine.ErrBadRequest("torrent is not queued")
+	}
+
+	target := queued[index]
+
+	samePriority := make([]uint, 0, len(queued))
+	for _, torrent := range queued {
+		if torrent.Priority == target.Priority && torrent.ID != id {
+			samePriority = append(samePriority, torrent.ID)
+		}
+	}
+
+	if position < 0 {
+		position = 0
+	}
+	if position > len(samePriority) {
+		position = len(samePriority)
+	}
+
+	samePriority = slices.Insert(samePriority, position, id)
+
+	if err := s.torrentRepo.SetQueueOrder(samePriority); err != nil {
+		return engine.ErrInternal(err.Error())
+	}
+
+	return nil
+}
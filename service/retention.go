@@ -0,0 +1,209 @@
+package service
+
+import (
+	"anileha/db"
+	"anileha/util"
+	"context"
+	"go.uber.org/zap"
+	"golang.org/x/exp/slices"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const retentionCheckInterval = 10 * time.Minute
+
+// sourceFile Converted source file that retention policy is allowed to delete
+type sourceFile struct {
+	torrentId   uint
+	file        db.TorrentFile
+	convertedAt time.Time // convertedAt time the last of its conversions became ready
+}
+
+// retentionWatcher Periodically deletes source files of converted torrents according to retention policy
+func (s *TorrentService) retentionWatcher(ctx context.Context) {
+	ticker := time.NewTicker(retentionCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.applyRetention()
+		}
+	}
+}
+
+func (s *TorrentService) applyRetention() {
+	retention := s.config.Data.Retention
+	if retention.KeepConvertedSec == 0 && retention.MaxSourceBytes == 0 {
+		return
+	}
+
+	torrents, err := s.torrentRepo.GetReady()
+	if err != nil {
+		s.log.Error("failed to get ready torrents", zap.Error(err))
+		return
+	}
+
+	torrentMap := make(map[uint]db.Torrent, len(torrents))
+	sources := make([]sourceFile, 0)
+	for _, torrent := range torrents {
+		if torrent.Series != nil && torrent.Series.Archive {
+			continue
+		}
+		// local sources can't be downloaded again
+		if torrent.Local && !retention.IncludeLocal {
+			continue
+		}
+		conversions, err := s.convertService.GetByTorrentId(torrent.ID)
+		if err != nil {
+			s.log.Error("failed to get torrent conversions",
+				zap.Uint("torrentId", torrent.ID),
+				zap.Error(err))
+			continue
+		}
+		torrentMap[torrent.ID] = torrent
+		sources = append(sources, convertedSources(torrent, conversions)...)
+	}
+
+	sourceBytes := int64(0)
+	if retention.MaxSourceBytes > 0 {
+		sourceBytes, err = dirSize(s.readyFolder)
+		if err != nil {
+			s.log.Error("failed to get ready dir size", zap.Error(err))
+			return
+		}
+	}
+
+	expired := selectExpiredSources(sources, time.Now(), time.Duration(retention.KeepConvertedSec)*time.Second,
+		sourceBytes, retention.MaxSourceBytes)
+
+	fileIds := make(map[uint][]uint)
+	for _, source := range expired {
+		fileIds[source.torrentId] = append(fileIds[source.torrentId], source.file.ID)
+	}
+	for torrentId, ids := range fileIds {
+		s.deleteSources(torrentMap[torrentId], ids)
+	}
+}
+
+// convertedSources Returns ready video files whose conversions are all ready, cancelled conversions are ignored
+func convertedSources(torrent db.Torrent, conversions []db.Conversion) []sourceFile {
+	sources := make([]sourceFile, 0, len(torrent.Files))
+	for _, file := range torrent.Files {
+		if file.ReadyPath == nil || file.Status != db.TorrentFileReady {
+			continue
+		}
+
+		converted := false
+		convertedAt := time.Time{}
+		for _, conversion := range conversions {
+			if conversion.TorrentFileId == nil || *conversion.TorrentFileId != file.ID ||
+				conversion.Status == db.ConversionCancelled {
+				continue
+			}
+			if conversion.Status != db.ConversionReady {
+				converted = false
+				break
+			}
+			converted = true
+			if conversion.UpdatedAt.After(convertedAt) {
+				convertedAt = conversion.UpdatedAt
+			}
+		}
+
+		if converted {
+			sources = append(sources, sourceFile{
+				torrentId:   torrent.ID,
+				file:        file,
+				convertedAt: convertedAt,
+			})
+		}
+	}
+	return sources
+}
+
+// selectExpiredSources Sources converted longer than keep ago expire, then the oldest ones expire
+// until source bytes fit the cap. Zero keep and zero cap disable the corresponding rule
+func selectExpiredSources(sources []sourceFile, now time.Time, keep time.Duration,
+	sourceBytes int64, maxSourceBytes int64) []sourceFile {
+	sorted := slices.Clone(sources)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].convertedAt.Before(sorted[j].convertedAt)
+	})
+
+	expired := make([]sourceFile, 0, len(sorted))
+	for _, source := range sorted {
+		expiredByAge := keep > 0 && now.Sub(source.convertedAt) >= keep
+		expiredBySize := maxSourceBytes > 0 && sourceBytes > maxSourceBytes
+		if !expiredByAge && !expiredBySize {
+			continue
+		}
+		expired = append(expired, source)
+		sourceBytes -= int64(source.file.Length)
+	}
+	return expired
+}
+
+// deleteSources Removes source files from ready folder, the rest of ready files are removed as well
+// once the torrent has no video sources left, e.g. subtitles and fonts
+func (s *TorrentService) deleteSources(torrent db.Torrent, fileIds []uint) {
+	deleted := make([]db.TorrentFile, 0, len(torrent.Files))
+	cleaned := true
+	for _, file := range torrent.Files {
+		if file.ReadyPath == nil {
+			continue
+		}
+		if slices.Contains(fileIds, file.ID) {
+			deleted = append(deleted, file)
+		} else if file.Type == util.FileTypeVideo {
+			cleaned = false
+		}
+	}
+	if cleaned {
+		deleted = deleted[:0]
+		for _, file := range torrent.Files {
+			if file.ReadyPath != nil {
+				deleted = append(deleted, file)
+			}
+		}
+	}
+
+	deletedIds := make([]uint, 0, len(deleted))
+	for _, file := range deleted {
+		deletedIds = append(deletedIds, file.ID)
+	}
+
+	if err := s.torrentRepo.DeleteSources(torrent.ID, deletedIds, cleaned); err != nil {
+		s.log.Error("failed to delete torrent sources",
+			zap.Uint("torrentId", torrent.ID),
+			zap.String("torrentName", torrent.Name),
+			zap.Error(err))
+		return
+	}
+
+	for _, file := range deleted {
+		if err := os.Remove(*file.ReadyPath); err != nil && !os.IsNotExist(err) {
+			s.log.Warn("failed to delete source file",
+				zap.Uint("torrentId", torrent.ID),
+				zap.String("path", *file.ReadyPath),
+				zap.Error(err))
+		}
+	}
+
+	if cleaned {
+		torrentIdStr := strconv.FormatUint(uint64(torrent.ID), 10)
+		_ = os.RemoveAll(path.Join(s.readyFolder, torrentIdStr))
+	}
+
+	s.publishTorrent(torrent.ID)
+
+	s.log.Info("deleted torrent sources by retention policy",
+		zap.Uint("torrentId", torrent.ID),
+		zap.String("torrentName", torrent.Name),
+		zap.Int("fileCount", len(deleted)),
+		zap.Bool("cleaned", cleaned))
+}
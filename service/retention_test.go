@@ -0,0 +1,60 @@
+package service
+
+import (
+	"anileha/db"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestConvertedSources(t *testing.T) {
+	readyPath := "ready"
+	now := time.Now()
+	fileId := func(id uint) *uint {
+		return &id
+	}
+	torrent := db.Torrent{
+		ID: 1,
+		Files: []db.TorrentFile{
+			{ID: 10, ReadyPath: &readyPath, Status: db.TorrentFileReady},
+			{ID: 11, ReadyPath: &readyPath, Status: db.TorrentFileReady},
+			{ID: 12, ReadyPath: &readyPath, Status: db.TorrentFileReady},
+			{ID: 13, Status: db.TorrentFileDeleted},
+		},
+	}
+	conversions := []db.Conversion{
+		{TorrentFileId: fileId(10), Status: db.ConversionReady, UpdatedAt: now.Add(-time.Hour)},
+		{TorrentFileId: fileId(10), Status: db.ConversionReady, UpdatedAt: now},
+		{TorrentFileId: fileId(10), Status: db.ConversionCancelled, UpdatedAt: now.Add(time.Hour)},
+		{TorrentFileId: fileId(11), Status: db.ConversionReady, UpdatedAt: now},
+		{TorrentFileId: fileId(11), Status: db.ConversionProcessing, UpdatedAt: now},
+		{TorrentFileId: fileId(13), Status: db.ConversionReady, UpdatedAt: now},
+	}
+
+	// files that are being converted or were never converted are kept
+	sources := convertedSources(torrent, conversions)
+	assert.Len(t, sources, 1)
+	assert.Equal(t, uint(10), sources[0].file.ID)
+	assert.Equal(t, now, sources[0].convertedAt)
+}
+
+func TestSelectExpiredSources(t *testing.T) {
+	now := time.Now()
+	sources := []sourceFile{
+		{file: db.TorrentFile{ID: 1, Length: 100}, convertedAt: now.Add(-time.Hour)},
+		{file: db.TorrentFile{ID: 2, Length: 100}, convertedAt: now.Add(-3 * time.Hour)},
+		{file: db.TorrentFile{ID: 3, Length: 100}, convertedAt: now.Add(-2 * time.Hour)},
+	}
+	ids := func(sources []sourceFile) []uint {
+		res := make([]uint, 0, len(sources))
+		for _, source := range sources {
+			res = append(res, source.file.ID)
+		}
+		return res
+	}
+
+	assert.Equal(t, []uint{2, 3}, ids(selectExpiredSources(sources, now, 90*time.Minute, 0, 0)))
+	// the oldest sources are deleted until the rest fits the cap
+	assert.Equal(t, []uint{2, 3}, ids(selectExpiredSources(sources, now, 0, 300, 150)))
+	assert.Empty(t, selectExpiredSources(sources, now, 0, 300, 0))
+}
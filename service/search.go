@@ -4,9 +4,11 @@ import (
 	"anileha/config"
 	"anileha/db"
 	"anileha/db/repo"
+	"anileha/rest/engine"
 	"anileha/search"
-	"anileha/search/nyaa"
+	"anileha/util/meta"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/elliotchance/pie/v2"
 	"go.uber.org/fx"
@@ -18,14 +20,40 @@ import (
 	"time"
 )
 
+// searchSeriesRepo Subset of repo.SeriesRepo used by SearchService, replaced with fakes in tests
+type searchSeriesRepo interface {
+	GetById(id uint) (*db.Series, error)
+	GetAllWithQuery() ([]db.Series, error)
+}
+
+type searchLastRssRepo interface {
+	GetLast(provider string, feedUrl string) (db.LastRSSUpdate, error)
+	SetLast(newEntry db.LastRSSUpdate) error
+}
+
+type searchPendingRssRepo interface {
+	GetAll() ([]db.PendingRSSItem, error)
+	Add(item *db.PendingRSSItem) error
+	SetAttempts(id uint, attempts int) error
+	DeleteById(id uint) (int64, error)
+}
+
+type searchTorrentService interface {
+	GetBySeriesId(seriesId uint) ([]db.Torrent, error)
+	GetExisting(infoHash string, source string) (*db.Torrent, error)
+	AddFromFile(seriesId uint, tempPath string, auto *db.AutoTorrent, release *meta.ReleaseInfo,
+		source *string) (uint, error)
+}
+
 type SearchService struct {
-	seriesRepo     *repo.SeriesRepo
-	lastRssRepo    *repo.LastRSSRepo
-	fileService    *FileService
-	torrentService *TorrentService
-	nyaaService    *nyaa.Service
-	log            *zap.Logger
-	config         *config.Config
+	seriesRepo       searchSeriesRepo
+	lastRssRepo      searchLastRssRepo
+	pendingRssRepo   searchPendingRssRepo
+	fileService      *FileService
+	torrentService   searchTorrentService
+	providerRegistry *search.Registry
+	log              *zap.Logger
+	config           *config.Config
 
 	pollCtx         context.Context
 	pollCancel      context.CancelFunc
@@ -36,22 +64,24 @@ type SearchService struct {
 func NewSearchService(
 	seriesRepo *repo.SeriesRepo,
 	lastRssRepo *repo.LastRSSRepo,
+	pendingRssRepo *repo.PendingRSSRepo,
 	fileService *FileService,
 	torrentService *TorrentService,
-	nyaaService *nyaa.Service,
+	providerRegistry *search.Registry,
 	log *zap.Logger,
 	config *config.Config,
 ) *SearchService {
 	pollCtx, pollCancel := context.WithCancel(context.Background())
 
 	searchService := &SearchService{
-		seriesRepo:     seriesRepo,
-		lastRssRepo:    lastRssRepo,
-		fileService:    fileService,
-		torrentService: torrentService,
-		nyaaService:    nyaaService,
-		log:            log,
-		config:         config,
+		seriesRepo:       seriesRepo,
+		lastRssRepo:      lastRssRepo,
+		pendingRssRepo:   pendingRssRepo,
+		fileService:      fileService,
+		torrentService:   torrentService,
+		providerRegistry: providerRegistry,
+		log:              log,
+		config:           config,
 
 		pollCtx:         pollCtx,
 		pollCancel:      pollCancel,
@@ -61,87 +91,314 @@ func NewSearchService(
 	return searchService
 }
 
-func (s *SearchService) test(ctx context.Context, result *search.ResultRSS, query *db.SeriesQuery) bool {
-	title := strings.ToLower(result.Title)
+func (s *SearchService) test(ctx context.Context, provider search.Provider, result *search.ResultRSS,
+	matcher *queryMatcher) (bool, error) {
+	reason, err := s.reject(ctx, provider, result, matcher)
+	return reason == RejectNone, err
+}
 
-	if !pie.All(query.Include, func(value string) bool {
-		return strings.Contains(title, value)
-	}) {
-		return false
+// reject Checks title and stats first, so that file list is requested only for releases that could match.
+// Error means that file list couldn't be loaded, so the release should be checked again later
+func (s *SearchService) reject(ctx context.Context, provider search.Provider, result *search.ResultRSS,
+	matcher *queryMatcher) (RejectReason, error) {
+	if reason := matcher.rejectTitle(result.Title); reason != RejectNone {
+		return reason, nil
 	}
 
-	if pie.Any(query.Exclude, func(value string) bool {
-		return strings.Contains(title, value)
-	}) {
-		return false
+	if reason := matcher.rejectStats(result); reason != RejectNone {
+		return reason, nil
 	}
 
-	if query.SingleFile {
-		extra, err := s.nyaaService.GetById(ctx, result.ID)
-		if err != nil {
-			s.log.Error("failed to get extra by id",
-				zap.String("id", result.ID),
-				zap.String("title", result.Title),
-				zap.Error(err))
-			return false
+	return s.rejectFiles(ctx, provider, result, matcher)
+}
+
+// rejectFiles Requests file list of the release if query needs it
+func (s *SearchService) rejectFiles(ctx context.Context, provider search.Provider, result *search.ResultRSS,
+	matcher *queryMatcher) (RejectReason, error) {
+	if !matcher.query.SingleFile {
+		return RejectNone, nil
+	}
+
+	extra, err := provider.GetById(ctx, result.ID)
+	if err != nil {
+		return RejectNoFileList, fmt.Errorf("failed to get extra by id: %w", err)
+	}
+
+	if len(extra.Files) != 1 {
+		s.log.Info("doesnt have single file, skipping",
+			zap.String("provider", provider.Name()),
+			zap.String("id", result.ID),
+			zap.String("title", result.Title),
+			zap.Int("files", len(extra.Files)))
+		return RejectNotSingleFile, nil
+	}
+
+	return RejectNone, nil
+}
+
+// releaseCandidate RSS item that matched series query
+type releaseCandidate struct {
+	result  search.ResultRSS
+	release meta.ReleaseInfo
+}
+
+// selectReleases Leaves only the best release of each episode if query has scoring,
+// releases that are not better than already downloaded ones are skipped
+func (s *SearchService) selectReleases(seriesId uint, matcher *queryMatcher,
+	matched []search.ResultRSS) ([]releaseCandidate, error) {
+	candidates := pie.Map(matched, func(result search.ResultRSS) releaseCandidate {
+		return releaseCandidate{
+			result:  result,
+			release: meta.ParseRelease(result.Title),
+		}
+	})
+
+	if matcher.query.Scoring == nil {
+		return candidates, nil
+	}
+
+	existingTorrents, err := s.torrentService.GetBySeriesId(seriesId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get series torrents: %w", err)
+	}
+
+	bestByEpisode := make(map[string]meta.ReleaseInfo, len(existingTorrents))
+
+	for _, torrent := range existingTorrents {
+		release := torrent.Release.Data()
+		if release == nil {
+			continue
 		}
+		key := release.EpisodeKey()
+		if best, exists := bestByEpisode[key]; !exists || matcher.isBetterRelease(*release, best) {
+			bestByEpisode[key] = *release
+		}
+	}
 
-		if len(extra.Files) != 1 {
-			s.log.Info("doesnt have single file, skipping",
-				zap.String("id", result.ID),
-				zap.String("title", result.Title),
-				zap.Int("files", len(extra.Files)))
-			return false
+	selected := make([]releaseCandidate, 0, len(candidates))
+	selectedIndexByEpisode := make(map[string]int, len(candidates))
+
+	for _, candidate := range candidates {
+		key := candidate.release.EpisodeKey()
+		if key == "" {
+			selected = append(selected, candidate)
+			continue
+		}
+
+		if best, exists := bestByEpisode[key]; exists && !matcher.isBetterRelease(candidate.release, best) {
+			s.log.Info("better release already exists, skipping",
+				zap.Uint("seriesId", seriesId),
+				zap.String("id", candidate.result.ID),
+				zap.String("title", candidate.result.Title),
+				zap.String("episode", key))
+			continue
+		}
+		bestByEpisode[key] = candidate.release
+
+		if index, exists := selectedIndexByEpisode[key]; exists {
+			selected[index] = candidate
+		} else {
+			selectedIndexByEpisode[key] = len(selected)
+			selected = append(selected, candidate)
 		}
 	}
 
-	return true
+	return selected, nil
 }
 
-func (s *SearchService) onMatch(ctx context.Context, seriesId uint, auto db.AutoTorrent, rssId string, rssTitle string) bool {
+// onMatch Downloads and adds matched torrent, returns engine.ErrTorrentAlreadyExists if it is already in the library,
+// other errors mean that item should be retried later
+func (s *SearchService) onMatch(ctx context.Context, provider search.Provider, seriesId uint, auto db.AutoTorrent,
+	candidate releaseCandidate) error {
+	rssId := candidate.result.ID
+	rssTitle := candidate.result.Title
+
+	existing, err := s.torrentService.GetExisting(candidate.result.InfoHash, candidate.result.Link)
+	if err != nil {
+		return fmt.Errorf("failed to check existing torrents: %w", err)
+	}
+	if existing != nil {
+		return engine.ErrTorrentAlreadyExists
+	}
+
 	s.log.Info("found rss match",
+		zap.String("provider", provider.Name()),
 		zap.String("id", rssId),
 		zap.String("title", rssTitle))
 
-	torrentBytes, err := s.nyaaService.DownloadById(ctx, rssId)
+	torrentBytes, err := provider.DownloadById(ctx, rssId)
 	if err != nil {
-		s.log.Error("failed to download torrent by id",
-			zap.String("id", rssId),
-			zap.String("title", rssTitle),
-			zap.Error(err))
-		return false
+		return fmt.Errorf("failed to download torrent by id: %w", err)
 	}
 
 	tempDst, err := s.fileService.GenTempFilePath("new.torrent")
 	if err != nil {
-		s.log.Error("failed to create temp file",
-			zap.String("id", rssId),
-			zap.String("title", rssTitle),
-			zap.Error(err))
-		return false
+		return fmt.Errorf("failed to create temp file: %w", err)
 	}
 	defer s.fileService.DeleteTempFileAsync(tempDst)
 
 	err = os.WriteFile(tempDst, torrentBytes, 0644)
 	if err != nil {
-		s.log.Error("failed to save torrent file",
-			zap.String("id", rssId),
-			zap.String("title", rssTitle),
+		return fmt.Errorf("failed to save torrent file: %w", err)
+	}
+
+	var source *string
+	if candidate.result.Link != "" {
+		source = &candidate.result.Link
+	}
+
+	_, err = s.torrentService.AddFromFile(seriesId, tempDst, &auto, &candidate.release, source)
+	if errors.Is(err, engine.ErrTorrentAlreadyExists) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to add new torrent: %w", err)
+	}
+
+	s.log.Info("successfully added new torrent", zap.String("title", rssTitle))
+	return nil
+}
+
+// addPending Stores item that couldn't be checked or added for retry, returns false if it couldn't be stored
+func (s *SearchService) addPending(provider search.Provider, seriesId uint, result search.ResultRSS) bool {
+	err := s.pendingRssRepo.Add(&db.PendingRSSItem{
+		SeriesId: seriesId,
+		Provider: provider.Name(),
+		RssId:    result.ID,
+		Title:    result.Title,
+		Link:     result.Link,
+	})
+	if err != nil {
+		s.log.Error("failed to save pending rss item",
+			zap.Uint("seriesId", seriesId),
+			zap.String("provider", provider.Name()),
+			zap.String("id", result.ID),
+			zap.String("title", result.Title),
 			zap.Error(err))
 		return false
 	}
+	return true
+}
+
+// deletePending Failed delete leaves item to be retried, already added torrents are then reported as duplicates
+func (s *SearchService) deletePending(item db.PendingRSSItem) {
+	if _, err := s.pendingRssRepo.DeleteById(item.ID); err != nil {
+		s.log.Error("failed to delete pending rss item",
+			zap.Uint("pendingId", item.ID),
+			zap.Uint("seriesId", item.SeriesId),
+			zap.String("id", item.RssId),
+			zap.Error(err))
+	}
+}
 
-	err = s.torrentService.AddFromFile(seriesId, tempDst, &auto)
+// retryPending Retries items that failed to be checked or added during previous polls,
+// items are dropped after config.Search.RssRetries failed attempts
+func (s *SearchService) retryPending(ctx context.Context) int {
+	items, err := s.pendingRssRepo.GetAll()
 	if err != nil {
-		s.log.Error("failed to add new torrent",
-			zap.String("id", rssId),
-			zap.String("title", rssTitle),
+		s.log.Error("failed to get pending rss items", zap.Error(err))
+		return 0
+	}
+
+	newCounter := 0
+
+	for _, item := range items {
+		select {
+		case <-ctx.Done():
+			return newCounter
+		default:
+		}
+
+		provider, err := s.providerRegistry.Get(item.Provider)
+		if err != nil {
+			s.log.Error("failed to get search provider of pending item",
+				zap.String("provider", item.Provider),
+				zap.String("id", item.RssId),
+				zap.Error(err))
+			continue
+		}
+
+		series, err := s.seriesRepo.GetById(item.SeriesId)
+		if err != nil || series == nil || series.Query == nil {
+			s.log.Warn("series of pending item has no query, dropping it",
+				zap.Uint("seriesId", item.SeriesId),
+				zap.String("id", item.RssId),
+				zap.String("title", item.Title))
+			s.deletePending(item)
+			continue
+		}
+
+		queryValue := series.Query.Data()
+
+		matcher, err := newQueryMatcher(&queryValue)
+		if err != nil {
+			s.log.Error("invalid series query",
+				zap.Uint("seriesId", series.ID),
+				zap.String("seriesTitle", series.Title),
+				zap.Error(err))
+			continue
+		}
+
+		result := search.ResultRSS{
+			ID:    item.RssId,
+			Title: item.Title,
+			Link:  item.Link,
+		}
+
+		// stats were checked when item was seen in the feed
+		reason := matcher.rejectTitle(result.Title)
+		if reason == RejectNone {
+			reason, err = s.rejectFiles(ctx, provider, &result, matcher)
+		}
+
+		var candidates []releaseCandidate
+		if err == nil && reason == RejectNone {
+			candidates, err = s.selectReleases(series.ID, matcher, []search.ResultRSS{result})
+		}
+
+		if err == nil && len(candidates) == 0 {
+			s.log.Info("pending rss item no longer matches, dropping it",
+				zap.Uint("seriesId", item.SeriesId),
+				zap.String("id", item.RssId),
+				zap.String("title", item.Title),
+				zap.String("reason", string(reason)))
+			s.deletePending(item)
+			continue
+		}
+
+		if err == nil {
+			err = s.onMatch(ctx, provider, series.ID, queryValue.Auto, candidates[0])
+		}
+		if err == nil || errors.Is(err, engine.ErrTorrentAlreadyExists) {
+			newCounter++
+			s.deletePending(item)
+			continue
+		}
+
+		attempts := item.Attempts + 1
+
+		s.log.Error("failed to retry pending rss item",
+			zap.Uint("seriesId", item.SeriesId),
+			zap.String("id", item.RssId),
+			zap.String("title", item.Title),
+			zap.Int("attempts", attempts),
 			zap.Error(err))
-		return false
+
+		if attempts >= s.config.Search.RssRetries {
+			s.log.Warn("giving up on pending rss item",
+				zap.Uint("seriesId", item.SeriesId),
+				zap.String("id", item.RssId),
+				zap.String("title", item.Title))
+			s.deletePending(item)
+			continue
+		}
+
+		if err := s.pendingRssRepo.SetAttempts(item.ID, attempts); err != nil {
+			s.log.Error("failed to update pending rss item", zap.Uint("pendingId", item.ID), zap.Error(err))
+		}
 	}
 
-	s.log.Info("successfully added new torrent", zap.String("title", rssTitle))
-	return true
+	return newCounter
 }
 
 func (s *SearchService) TriggerRSSPoll() {
@@ -152,95 +409,136 @@ func (s *SearchService) TriggerRSSPoll() {
 	}
 }
 
-func (s *SearchService) SearchOld(ctx context.Context, query db.SeriesQuery) ([]search.Result, error) {
-	results := make([]search.Result, 0, 100)
+// QueryTestCandidate Result of testing a single release against series query
+type QueryTestCandidate struct {
+	// Source Either rss or search
+	Source   string
+	Provider string
+	ID       string
+	Title    string
+	Link     string
+	Reason   RejectReason
+	Metadata meta.EpisodeMetadata
+	Release  meta.ReleaseInfo
+}
 
-	for page := 0; ; page++ {
-		curResults, err := s.nyaaService.Search(ctx, search.Query{
-			Query:    strings.Join(query.Include, " "),
-			SortType: search.SortDate,
-			Page:     page,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to search torrents: %w", err)
-		}
+// TestQuery Runs query against current RSS feed and first config.Search.TestQueryPages pages of search
+// without adding anything
+func (s *SearchService) TestQuery(ctx context.Context, query db.SeriesQuery) ([]QueryTestCandidate, error) {
+	provider, err := s.providerRegistry.Get(query.Provider)
+	if err != nil {
+		return nil, engine.ErrBadRequest(err.Error())
+	}
 
-		results = append(results, curResults...)
+	matcher, err := newQueryMatcher(&query)
+	if err != nil {
+		return nil, engine.ErrBadRequest(err.Error())
+	}
 
-		if len(curResults) == 0 {
-			break
-		}
+	if _, err := provider.RSSUrl(queryFeed(&query)); err != nil {
+		return nil, engine.ErrBadRequest(err.Error())
 	}
 
-	results = pie.Filter(results, func(result search.Result) bool {
-		title := strings.ToLower(result.Title)
+	feed, err := provider.GetRSS(ctx, queryFeed(&query))
+	if err != nil {
+		return nil, engine.ErrInternal(fmt.Sprintf("failed to get RSS feed: %s", err.Error()))
+	}
 
-		return !pie.Any(query.Exclude, func(value string) bool {
-			return strings.Contains(title, value)
-		})
-	})
+	candidates := make([]QueryTestCandidate, 0, len(feed))
+	visited := make(map[string]struct{}, len(feed))
 
-	if query.SingleFile {
-		results = pie.Filter(results, func(result search.Result) bool {
-			extra, err := s.nyaaService.GetById(ctx, result.ID)
-			if err != nil {
-				s.log.Error("failed to get extra by id",
-					zap.String("id", result.ID),
-					zap.String("title", result.Title),
-					zap.Error(err))
-				return false
-			}
+	addCandidate := func(source string, item search.ResultRSS, matcher *queryMatcher) {
+		if _, exists := visited[item.ID]; exists {
+			return
+		}
+		visited[item.ID] = struct{}{}
 
-			if len(extra.Files) != 1 {
-				s.log.Info("doesnt have single file, skipping",
-					zap.String("id", result.ID),
-					zap.String("title", result.Title),
-					zap.Int("files", len(extra.Files)))
-				return false
-			}
+		reason, err := s.reject(ctx, provider, &item, matcher)
+		if err != nil {
+			s.log.Warn("failed to check release",
+				zap.String("provider", provider.Name()),
+				zap.String("id", item.ID),
+				zap.String("title", item.Title),
+				zap.Error(err))
+		}
 
-			return true
+		candidates = append(candidates, QueryTestCandidate{
+			Source:   source,
+			Provider: provider.Name(),
+			ID:       item.ID,
+			Title:    item.Title,
+			Link:     item.Link,
+			Reason:   reason,
+			Metadata: meta.GuessTitleMetadata(item.Title),
+			Release:  meta.ParseRelease(item.Title),
 		})
 	}
 
-	return results, nil
-}
+	for _, item := range feed {
+		addCandidate("rss", item, matcher.feedMatcher())
+	}
 
-func (s *SearchService) doPoll(ctx context.Context) error {
-	lastRss, err := s.lastRssRepo.GetLast()
-	if err != nil {
-		return fmt.Errorf("failed to get last rss poll timestamp: %w", err)
+	for page := 0; page < s.config.Search.TestQueryPages; page++ {
+		results, err := provider.Search(ctx, search.Query{
+			Query:    strings.Join(query.Include, " "),
+			SortType: search.SortDate,
+			Page:     page,
+			Category: query.Category,
+			Filter:   search.SiteFilter(query.SiteFilter),
+		})
+		if err != nil {
+			return nil, engine.ErrInternal(fmt.Sprintf("failed to search torrents: %s", err.Error()))
+		}
+
+		if len(results) == 0 {
+			break
+		}
+
+		for _, result := range results {
+			addCandidate("search", result.RSS(), matcher)
+		}
 	}
-	lastRssId, _ := strconv.Atoi(lastRss.RssId)
 
-	seriesWithQueries, err := s.seriesRepo.GetAllWithQuery()
+	return candidates, nil
+}
+
+// pollFeed Matches new items of provider's RSS feed against given series, returns number of added torrents.
+// Feed cursor is advanced only if every matched item was either added or saved for retry
+func (s *SearchService) pollFeed(ctx context.Context, provider search.Provider, feed search.Feed, feedUrl string,
+	seriesArr []db.Series) (int, error) {
+	lastRss, err := s.lastRssRepo.GetLast(provider.Name(), feedUrl)
 	if err != nil {
-		return fmt.Errorf("failed to get series with queries: %w", err)
+		return 0, fmt.Errorf("failed to get last rss poll timestamp: %w", err)
 	}
 
-	if len(seriesWithQueries) == 0 {
-		return fmt.Errorf("no series with queries found")
-	}
+	lastRssId, _ := strconv.Atoi(lastRss.RssId)
 
-	feed, err := s.nyaaService.GetRSS(ctx)
+	items, err := provider.GetRSS(ctx, feed)
 	if err != nil {
-		return fmt.Errorf("failed to get RSS feed: %w", err)
+		return 0, fmt.Errorf("failed to get RSS feed: %w", err)
 	}
 
-	if len(feed) == 0 {
-		return fmt.Errorf("feed is empty")
+	if len(items) == 0 {
+		return 0, fmt.Errorf("feed is empty")
 	} else {
-		s.log.Info("got rss feed", zap.Int("items", len(feed)))
+		s.log.Info("got rss feed",
+			zap.String("provider", provider.Name()),
+			zap.String("feedUrl", feedUrl),
+			zap.Int("items", len(items)))
 	}
 
-	var timestamp time.Time
+	newest := db.LastRSSUpdate{
+		Provider: provider.Name(),
+		FeedUrl:  feedUrl,
+		RssId:    items[0].ID,
+	}
 
-	if feed[0].Timestamp != nil {
-		timestamp = *feed[0].Timestamp
+	if items[0].Timestamp != nil {
+		newest.Timestamp = *items[0].Timestamp
 	}
 
-	feedLenBefore := len(feed)
-	feed = pie.Reverse(pie.Filter(feed, func(rss search.ResultRSS) bool {
+	feedLenBefore := len(items)
+	items = pie.Reverse(pie.Filter(items, func(rss search.ResultRSS) bool {
 		if rss.Timestamp != nil {
 			return rss.Timestamp.After(lastRss.Timestamp)
 		}
@@ -249,25 +547,137 @@ func (s *SearchService) doPoll(ctx context.Context) error {
 
 		return curId >= lastRssId
 	}))
-	feedLenAfter := len(feed)
+	feedLenAfter := len(items)
 
 	if feedLenAfter < feedLenBefore {
-		s.log.Info("removed old feed items", zap.Int("newCount", feedLenAfter))
+		s.log.Info("removed old feed items",
+			zap.String("provider", provider.Name()),
+			zap.String("feedUrl", feedUrl),
+			zap.Int("newCount", feedLenAfter))
 	}
 
 	if feedLenAfter == 0 {
-		return fmt.Errorf("no new feed items since last time")
+		return 0, fmt.Errorf("no new feed items since last time")
 	}
 
 	newCounter := 0
+	persisted := true
 
-	for _, series := range seriesWithQueries {
+	for _, series := range seriesArr {
 		select {
 		case <-ctx.Done():
-			return fmt.Errorf("rss poll interrupted")
+			return newCounter, fmt.Errorf("rss poll interrupted")
 		default:
 		}
 
+		queryValue := series.Query.Data()
+
+		matcher, err := newQueryMatcher(&queryValue)
+		if err != nil {
+			s.log.Error("invalid series query",
+				zap.Uint("seriesId", series.ID),
+				zap.String("seriesTitle", series.Title),
+				zap.Error(err))
+			continue
+		}
+
+		matched := make([]search.ResultRSS, 0, len(items))
+		feedMatcher := matcher.feedMatcher()
+
+		for _, result := range items {
+			matches, err := s.test(ctx, provider, &result, feedMatcher)
+			if err != nil {
+				s.log.Error("failed to check rss item, it will be retried on the next poll",
+					zap.Uint("seriesId", series.ID),
+					zap.String("id", result.ID),
+					zap.String("title", result.Title),
+					zap.Error(err))
+				if !s.addPending(provider, series.ID, result) {
+					persisted = false
+				}
+				continue
+			}
+			if matches {
+				matched = append(matched, result)
+			}
+		}
+
+		candidates, err := s.selectReleases(series.ID, matcher, matched)
+		if err != nil {
+			s.log.Error("failed to select releases",
+				zap.Uint("seriesId", series.ID),
+				zap.String("seriesTitle", series.Title),
+				zap.Error(err))
+			persisted = false
+			continue
+		}
+
+		for _, candidate := range candidates {
+			err := s.onMatch(ctx, provider, series.ID, queryValue.Auto, candidate)
+			if errors.Is(err, engine.ErrTorrentAlreadyExists) {
+				s.log.Info("torrent is already in the library, skipping",
+					zap.Uint("seriesId", series.ID),
+					zap.String("id", candidate.result.ID),
+					zap.String("title", candidate.result.Title))
+				continue
+			}
+			if err != nil {
+				s.log.Error("failed to add matched torrent, it will be retried on the next poll",
+					zap.Uint("seriesId", series.ID),
+					zap.String("id", candidate.result.ID),
+					zap.String("title", candidate.result.Title),
+					zap.Error(err))
+				if !s.addPending(provider, series.ID, candidate.result) {
+					persisted = false
+				}
+				continue
+			}
+			newCounter++
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return newCounter, fmt.Errorf("rss poll interrupted")
+	default:
+	}
+
+	if !persisted {
+		return newCounter, fmt.Errorf("not all matched items were saved, feed cursor is not advanced")
+	}
+
+	if err := s.lastRssRepo.SetLast(newest); err != nil {
+		return newCounter, fmt.Errorf("failed to save last rss timestamp: %w", err)
+	}
+
+	return newCounter, nil
+}
+
+func (s *SearchService) doPoll(ctx context.Context) error {
+	newCounter := s.retryPending(ctx)
+
+	seriesWithQueries, err := s.seriesRepo.GetAllWithQuery()
+	if err != nil {
+		return fmt.Errorf("failed to get series with queries: %w", err)
+	}
+
+	if len(seriesWithQueries) == 0 {
+		return fmt.Errorf("no series with queries found")
+	}
+
+	// group series by feed, so that each feed is loaded only once
+	type feedKey struct {
+		provider string
+		url      string
+	}
+	type feedSeries struct {
+		provider search.Provider
+		feed     search.Feed
+		series   []db.Series
+	}
+	seriesByFeed := make(map[feedKey]*feedSeries)
+
+	for _, series := range seriesWithQueries {
 		query := series.Query
 		if query == nil {
 			s.log.Error("query is nil",
@@ -278,15 +688,52 @@ func (s *SearchService) doPoll(ctx context.Context) error {
 
 		queryValue := (*query).Data()
 
-		for _, result := range feed {
-			if !s.test(ctx, &result, &queryValue) {
-				continue
-			}
+		provider, err := s.providerRegistry.Get(queryValue.Provider)
+		if err != nil {
+			s.log.Error("failed to get search provider",
+				zap.Uint("seriesId", series.ID),
+				zap.String("provider", queryValue.Provider),
+				zap.Error(err))
+			continue
+		}
+
+		feed := queryFeed(&queryValue)
+
+		feedUrl, err := provider.RSSUrl(feed)
+		if err != nil {
+			s.log.Error("invalid series feed",
+				zap.Uint("seriesId", series.ID),
+				zap.String("provider", queryValue.Provider),
+				zap.Error(err))
+			continue
+		}
 
-			if s.onMatch(ctx, series.ID, queryValue.Auto, result.ID, result.Title) {
-				newCounter++
+		key := feedKey{provider: provider.Name(), url: feedUrl}
+		if _, exists := seriesByFeed[key]; !exists {
+			seriesByFeed[key] = &feedSeries{
+				provider: provider,
+				feed:     feed,
 			}
 		}
+		seriesByFeed[key].series = append(seriesByFeed[key].series, series)
+	}
+
+	for key, group := range seriesByFeed {
+		count, err := s.pollFeed(ctx, group.provider, group.feed, key.url, group.series)
+		newCounter += count
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("rss poll interrupted")
+		default:
+		}
+
+		if err != nil {
+			s.log.Warn("feed poll error",
+				zap.String("provider", key.provider),
+				zap.String("feedUrl", key.url),
+				zap.Error(err))
+		}
 	}
 
 	if newCounter > 0 {
@@ -295,13 +742,6 @@ func (s *SearchService) doPoll(ctx context.Context) error {
 		s.log.Info("no new torrents found", zap.Int("count", newCounter))
 	}
 
-	if err := s.lastRssRepo.SetLast(db.LastRSSUpdate{
-		RssId:     feed[0].ID,
-		Timestamp: timestamp,
-	}); err != nil {
-		return fmt.Errorf("failed to save last rss timestamp: %w", err)
-	}
-
 	return nil
 }
 
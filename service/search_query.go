@@ -0,0 +1,198 @@
+package service
+
+import (
+	"anileha/db"
+	"anileha/search"
+	"anileha/util/meta"
+	"fmt"
+	"github.com/elliotchance/pie/v2"
+	"regexp"
+	"strings"
+)
+
+// queryMatcher Tests release titles against db.SeriesQuery, holds compiled regular expressions
+type queryMatcher struct {
+	query        *db.SeriesQuery
+	includeRegex *regexp.Regexp
+	excludeRegex *regexp.Regexp
+}
+
+// RejectReason Explains why release didn't match series query
+type RejectReason string
+
+const (
+	RejectNone          RejectReason = ""
+	RejectInclude       RejectReason = "failed_include"
+	RejectExclude       RejectReason = "hit_exclude"
+	RejectIncludeRegex  RejectReason = "failed_include_regex"
+	RejectExcludeRegex  RejectReason = "hit_exclude_regex"
+	RejectEpisodeRange  RejectReason = "out_of_episode_range"
+	RejectNotTrusted    RejectReason = "not_trusted"
+	RejectFewSeeders    RejectReason = "few_seeders"
+	RejectNotSingleFile RejectReason = "not_single_file"
+	RejectNoFileList    RejectReason = "file_list_unavailable"
+)
+
+// queryFeed Returns RSS feed polled for the query
+func queryFeed(query *db.SeriesQuery) search.Feed {
+	return search.Feed{
+		Url:      query.FeedUrl,
+		Params:   query.FeedParams,
+		Category: query.Category,
+		Filter:   search.SiteFilter(query.SiteFilter),
+	}
+}
+
+func compileQueryRegex(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile(pattern)
+}
+
+func newQueryMatcher(query *db.SeriesQuery) (*queryMatcher, error) {
+	includeRegex, err := compileQueryRegex(query.IncludeRegex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid include regex: %w", err)
+	}
+
+	excludeRegex, err := compileQueryRegex(query.ExcludeRegex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exclude regex: %w", err)
+	}
+
+	if query.MinEpisode != nil && query.MaxEpisode != nil && *query.MinEpisode > *query.MaxEpisode {
+		return nil, fmt.Errorf("min episode is greater than max episode")
+	}
+
+	return &queryMatcher{
+		query:        query,
+		includeRegex: includeRegex,
+		excludeRegex: excludeRegex,
+	}, nil
+}
+
+// searchMatcher Include words are sent to provider search, so search results are not filtered by them again
+func (m *queryMatcher) searchMatcher() *queryMatcher {
+	query := *m.query
+	query.Include = nil
+	return &queryMatcher{
+		query:        &query,
+		includeRegex: m.includeRegex,
+		excludeRegex: m.excludeRegex,
+	}
+}
+
+// feedMatcher Fresh RSS items have barely any seeders yet, so seeders are only checked for search results
+func (m *queryMatcher) feedMatcher() *queryMatcher {
+	query := *m.query
+	query.MinSeeders = 0
+	return &queryMatcher{
+		query:        &query,
+		includeRegex: m.includeRegex,
+		excludeRegex: m.excludeRegex,
+	}
+}
+
+func (m *queryMatcher) testTitle(title string) bool {
+	return m.rejectTitle(title) == RejectNone
+}
+
+// rejectTitle Returns the first check that title failed, RejectNone if title matches the query
+func (m *queryMatcher) rejectTitle(title string) RejectReason {
+	lowerTitle := strings.ToLower(title)
+
+	if !pie.All(m.query.Include, func(value string) bool {
+		return strings.Contains(lowerTitle, value)
+	}) {
+		return RejectInclude
+	}
+
+	if pie.Any(m.query.Exclude, func(value string) bool {
+		return strings.Contains(lowerTitle, value)
+	}) {
+		return RejectExclude
+	}
+
+	if m.includeRegex != nil && !m.includeRegex.MatchString(title) {
+		return RejectIncludeRegex
+	}
+
+	if m.excludeRegex != nil && m.excludeRegex.MatchString(title) {
+		return RejectExcludeRegex
+	}
+
+	if !m.testEpisode(meta.GuessTitleMetadata(title)) {
+		return RejectEpisodeRange
+	}
+
+	return RejectNone
+}
+
+// rejectStats Checks uploader status and seeders reported by provider,
+// uploader status is ignored if provider doesn't report it
+func (m *queryMatcher) rejectStats(result *search.ResultRSS) RejectReason {
+	if m.query.TrustedOnly && result.TrustReported && !result.Trusted {
+		return RejectNotTrusted
+	}
+
+	if result.Seeders < m.query.MinSeeders {
+		return RejectFewSeeders
+	}
+
+	return RejectNone
+}
+
+func (m *queryMatcher) testEpisode(metadata meta.EpisodeMetadata) bool {
+	if m.query.MinEpisode == nil && m.query.MaxEpisode == nil {
+		return true
+	}
+
+	episode, ok := metadata.EpisodeNumber()
+	if !ok {
+		return false
+	}
+
+	if m.query.MinEpisode != nil && episode < *m.query.MinEpisode {
+		return false
+	}
+
+	if m.query.MaxEpisode != nil && episode > *m.query.MaxEpisode {
+		return false
+	}
+
+	return true
+}
+
+// rankValue Returns a higher value for entries closer to the start of preference list, 0 if value is not in the list
+func rankValue(preferences []string, value string) int {
+	for i, preference := range preferences {
+		if strings.EqualFold(preference, value) {
+			return len(preferences) - i
+		}
+	}
+	return 0
+}
+
+// scoreRelease Groups are more important than resolutions, resolutions are more important than codecs
+func (m *queryMatcher) scoreRelease(release meta.ReleaseInfo) int {
+	scoring := m.query.Scoring
+	if scoring == nil {
+		return 0
+	}
+	return rankValue(scoring.Groups, release.Group)*10000 +
+		rankValue(scoring.Resolutions, release.Resolution)*100 +
+		rankValue(scoring.Codecs, release.Codec)
+}
+
+// isBetterRelease Checks whether candidate should replace current release of the same episode
+func (m *queryMatcher) isBetterRelease(candidate meta.ReleaseInfo, current meta.ReleaseInfo) bool {
+	candidateScore := m.scoreRelease(candidate)
+	currentScore := m.scoreRelease(current)
+	if candidateScore != currentScore {
+		return candidateScore > currentScore
+	}
+	return m.query.Scoring != nil && m.query.Scoring.PreferV2 &&
+		strings.EqualFold(candidate.Group, current.Group) &&
+		candidate.Version > current.Version
+}
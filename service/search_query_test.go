@@ -0,0 +1,175 @@
+package service
+
+import (
+	"anileha/db"
+	"anileha/search"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func episodeBound(value float64) *float64 {
+	return &value
+}
+
+func TestRejectTitle(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  db.SeriesQuery
+		title  string
+		reason RejectReason
+	}{
+		{
+			name:   "empty query",
+			title:  "[SubsPlease] Jigokuraku - 01 (1080p) [A1B2C3D4].mkv",
+			reason: RejectNone,
+		},
+		{
+			name:   "include is case insensitive",
+			query:  db.SeriesQuery{Include: []string{"subsplease", "jigokuraku"}},
+			title:  "[SubsPlease] Jigokuraku - 01 (1080p) [A1B2C3D4].mkv",
+			reason: RejectNone,
+		},
+		{
+			name:   "all include words required",
+			query:  db.SeriesQuery{Include: []string{"jigokuraku", "720p"}},
+			title:  "[SubsPlease] Jigokuraku - 01 (1080p) [A1B2C3D4].mkv",
+			reason: RejectInclude,
+		},
+		{
+			name:   "exclude",
+			query:  db.SeriesQuery{Exclude: []string{"batch"}},
+			title:  "[SubsPlease] Jigokuraku (01-13) (1080p) [Batch]",
+			reason: RejectExclude,
+		},
+		{
+			name:   "include regex",
+			query:  db.SeriesQuery{IncludeRegex: `\(1080p\)`},
+			title:  "[SubsPlease] Jigokuraku - 01 (720p) [A1B2C3D4].mkv",
+			reason: RejectIncludeRegex,
+		},
+		{
+			name:   "include regex is case sensitive",
+			query:  db.SeriesQuery{IncludeRegex: `^\[SubsPlease\]`},
+			title:  "[subsplease] Jigokuraku - 01 (1080p) [A1B2C3D4].mkv",
+			reason: RejectIncludeRegex,
+		},
+		{
+			name:   "exclude regex",
+			query:  db.SeriesQuery{ExcludeRegex: `(?i)\bv2\b`},
+			title:  "[Erai-raws] Blue Lock - 24 V2 [1080p][Multiple Subtitle]",
+			reason: RejectExcludeRegex,
+		},
+		{
+			name:   "episode in range",
+			query:  db.SeriesQuery{MinEpisode: episodeBound(1), MaxEpisode: episodeBound(12)},
+			title:  "[SubsPlease] Jigokuraku - 12 (1080p) [A1B2C3D4].mkv",
+			reason: RejectNone,
+		},
+		{
+			name:   "episode below range",
+			query:  db.SeriesQuery{MinEpisode: episodeBound(2)},
+			title:  "[SubsPlease] Jigokuraku - 01 (1080p) [A1B2C3D4].mkv",
+			reason: RejectEpisodeRange,
+		},
+		{
+			name:   "episode above range",
+			query:  db.SeriesQuery{MaxEpisode: episodeBound(12)},
+			title:  "[SubsPlease] Jigokuraku - 13 (1080p) [A1B2C3D4].mkv",
+			reason: RejectEpisodeRange,
+		},
+		{
+			name:   "range requires episode number",
+			query:  db.SeriesQuery{MinEpisode: episodeBound(1)},
+			title:  "[SubsPlease] Jigokuraku (1080p) [Batch]",
+			reason: RejectEpisodeRange,
+		},
+		{
+			name:   "include is checked before regex",
+			query:  db.SeriesQuery{Include: []string{"blue lock"}, IncludeRegex: `1080p`},
+			title:  "[SubsPlease] Jigokuraku - 01 (720p) [A1B2C3D4].mkv",
+			reason: RejectInclude,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matcher, err := newQueryMatcher(&test.query)
+			require.Nil(t, err)
+			assert.Equal(t, test.reason, matcher.rejectTitle(test.title))
+		})
+	}
+}
+
+func TestNewQueryMatcherValidation(t *testing.T) {
+	_, err := newQueryMatcher(&db.SeriesQuery{IncludeRegex: "("})
+	assert.NotNil(t, err)
+
+	_, err = newQueryMatcher(&db.SeriesQuery{ExcludeRegex: "["})
+	assert.NotNil(t, err)
+
+	_, err = newQueryMatcher(&db.SeriesQuery{MinEpisode: episodeBound(5), MaxEpisode: episodeBound(1)})
+	assert.NotNil(t, err)
+}
+
+func TestSearchMatcherSkipsInclude(t *testing.T) {
+	query := db.SeriesQuery{Include: []string{"jigokuraku"}, Exclude: []string{"batch"}}
+	matcher, err := newQueryMatcher(&query)
+	require.Nil(t, err)
+
+	searchMatcher := matcher.searchMatcher()
+	assert.Equal(t, RejectNone, searchMatcher.rejectTitle("Hell's Paradise - 01 (1080p)"))
+	assert.Equal(t, RejectExclude, searchMatcher.rejectTitle("Hell's Paradise (01-13) Batch"))
+	// original query is left untouched
+	assert.Equal(t, []string{"jigokuraku"}, query.Include)
+}
+
+func TestRejectStats(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  db.SeriesQuery
+		result search.ResultRSS
+		reason RejectReason
+	}{
+		{
+			name:   "trusted",
+			query:  db.SeriesQuery{TrustedOnly: true},
+			result: search.ResultRSS{Trusted: true, TrustReported: true},
+			reason: RejectNone,
+		},
+		{
+			name:   "not trusted",
+			query:  db.SeriesQuery{TrustedOnly: true},
+			result: search.ResultRSS{TrustReported: true},
+			reason: RejectNotTrusted,
+		},
+		{
+			name:   "trust is not reported by provider",
+			query:  db.SeriesQuery{TrustedOnly: true},
+			result: search.ResultRSS{},
+			reason: RejectNone,
+		},
+		{
+			name:   "few seeders",
+			query:  db.SeriesQuery{MinSeeders: 10},
+			result: search.ResultRSS{Seeders: 9},
+			reason: RejectFewSeeders,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matcher, err := newQueryMatcher(&test.query)
+			require.Nil(t, err)
+			assert.Equal(t, test.reason, matcher.rejectStats(&test.result))
+		})
+	}
+}
+
+func TestFeedMatcherSkipsSeeders(t *testing.T) {
+	matcher, err := newQueryMatcher(&db.SeriesQuery{MinSeeders: 10})
+	require.Nil(t, err)
+
+	assert.Equal(t, RejectNone, matcher.feedMatcher().rejectStats(&search.ResultRSS{Seeders: 0}))
+	assert.Equal(t, 10, matcher.query.MinSeeders)
+}
@@ -0,0 +1,381 @@
+package service
+
+import (
+	"anileha/config"
+	"anileha/db"
+	"anileha/rest/engine"
+	"anileha/search"
+	"anileha/search/nyaa"
+	"anileha/search/searchtest"
+	"anileha/util/meta"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type fakeSeriesRepo struct {
+	series []db.Series
+}
+
+func (r *fakeSeriesRepo) GetById(id uint) (*db.Series, error) {
+	for i := range r.series {
+		if r.series[i].ID == id {
+			return &r.series[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeSeriesRepo) GetAllWithQuery() ([]db.Series, error) {
+	return r.series, nil
+}
+
+type fakeLastRssRepo struct {
+	entries map[string]db.LastRSSUpdate
+}
+
+func (r *fakeLastRssRepo) GetLast(provider string, feedUrl string) (db.LastRSSUpdate, error) {
+	return r.entries[provider+" "+feedUrl], nil
+}
+
+func (r *fakeLastRssRepo) SetLast(newEntry db.LastRSSUpdate) error {
+	r.entries[newEntry.Provider+" "+newEntry.FeedUrl] = newEntry
+	return nil
+}
+
+type fakePendingRssRepo struct {
+	items  []db.PendingRSSItem
+	lastId uint
+}
+
+func (r *fakePendingRssRepo) GetAll() ([]db.PendingRSSItem, error) {
+	return append([]db.PendingRSSItem(nil), r.items...), nil
+}
+
+func (r *fakePendingRssRepo) Add(item *db.PendingRSSItem) error {
+	for _, existing := range r.items {
+		if existing.SeriesId == item.SeriesId && existing.Provider == item.Provider && existing.RssId == item.RssId {
+			return nil
+		}
+	}
+	r.lastId++
+	item.ID = r.lastId
+	r.items = append(r.items, *item)
+	return nil
+}
+
+func (r *fakePendingRssRepo) SetAttempts(id uint, attempts int) error {
+	for i := range r.items {
+		if r.items[i].ID == id {
+			r.items[i].Attempts = attempts
+		}
+	}
+	return nil
+}
+
+func (r *fakePendingRssRepo) DeleteById(id uint) (int64, error) {
+	for i := range r.items {
+		if r.items[i].ID == id {
+			r.items = append(r.items[:i], r.items[i+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+type fakeTorrentService struct {
+	torrents []db.Torrent
+}
+
+func (s *fakeTorrentService) GetBySeriesId(seriesId uint) ([]db.Torrent, error) {
+	result := make([]db.Torrent, 0, len(s.torrents))
+	for _, torrent := range s.torrents {
+		if torrent.SeriesId != nil && *torrent.SeriesId == seriesId {
+			result = append(result, torrent)
+		}
+	}
+	return result, nil
+}
+
+func (s *fakeTorrentService) GetExisting(infoHash string, source string) (*db.Torrent, error) {
+	for i, torrent := range s.torrents {
+		if (infoHash != "" && torrent.InfoHash == infoHash) ||
+			(source != "" && torrent.Source != nil && *torrent.Source == source) {
+			return &s.torrents[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *fakeTorrentService) AddFromFile(seriesId uint, tempPath string, auto *db.AutoTorrent,
+	release *meta.ReleaseInfo, source *string) (uint, error) {
+	infoHash, err := readInfoHash(tempPath)
+	if err != nil {
+		return 0, err
+	}
+
+	if existing, _ := s.GetExisting(infoHash, ""); existing != nil {
+		return existing.ID, engine.ErrTorrentAlreadyExists
+	}
+
+	torrent := db.Torrent{
+		ID:       uint(len(s.torrents) + 1),
+		SeriesId: &seriesId,
+		Auto:     datatypes.NewJSONType(auto),
+		InfoHash: infoHash,
+		Source:   source,
+		Release:  datatypes.NewJSONType(release),
+	}
+	s.torrents = append(s.torrents, torrent)
+
+	return torrent.ID, nil
+}
+
+type searchTestEnv struct {
+	service        *SearchService
+	server         *searchtest.FixtureServer
+	lastRssRepo    *fakeLastRssRepo
+	pendingRssRepo *fakePendingRssRepo
+	torrentService *fakeTorrentService
+
+	mutex           sync.Mutex
+	failedDownloads map[string]int
+	failedViews     map[string]int
+}
+
+// newSearchTestEnv Replays nyaa fixtures, downloads and view pages of ids present in failedDownloads
+// and failedViews fail the given number of times
+func newSearchTestEnv(t *testing.T, series []db.Series, torrents []db.Torrent) *searchTestEnv {
+	env := &searchTestEnv{
+		server:          searchtest.NewFixtureServerAt(t, "../search/nyaa/testdata"),
+		lastRssRepo:     &fakeLastRssRepo{entries: make(map[string]db.LastRSSUpdate)},
+		pendingRssRepo:  &fakePendingRssRepo{},
+		torrentService:  &fakeTorrentService{torrents: torrents},
+		failedDownloads: make(map[string]int),
+		failedViews:     make(map[string]int),
+	}
+
+	env.server.Serve("/rss", "rss.xml", "application/rss+xml")
+	for _, id := range []string{"1654000", "1654001", "1654002", "1654003"} {
+		id := id
+		env.server.Handle("/download/"+id+".torrent", func(w http.ResponseWriter, r *http.Request) {
+			env.mutex.Lock()
+			fail := env.failedDownloads[id] > 0
+			if fail {
+				env.failedDownloads[id]--
+			}
+			env.mutex.Unlock()
+
+			if fail {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			_, _ = w.Write(searchtest.GenTorrentBytes(t, id, id+".mkv"))
+		})
+		env.server.Handle("/view/"+id, func(w http.ResponseWriter, r *http.Request) {
+			env.mutex.Lock()
+			fail := env.failedViews[id] > 0
+			if fail {
+				env.failedViews[id]--
+			}
+			env.mutex.Unlock()
+
+			if fail {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			env.server.WriteFixture(w, "view.html", "text/html")
+		})
+	}
+
+	cfg := config.GetDefaultConfig()
+	cfg.Search.RateLimit.IntervalMs = 1
+	cfg.Search.Nyaa.BaseUrl = env.server.URL
+
+	provider, err := nyaa.NewService(&cfg, zap.NewNop())
+	require.Nil(t, err)
+
+	registry, err := search.NewRegistry(search.RegistryParams{
+		Config:    &cfg,
+		Providers: []search.Provider{provider},
+	})
+	require.Nil(t, err)
+
+	env.service = &SearchService{
+		seriesRepo:       &fakeSeriesRepo{series: series},
+		lastRssRepo:      env.lastRssRepo,
+		pendingRssRepo:   env.pendingRssRepo,
+		fileService:      &FileService{log: zap.NewNop(), tempDir: t.TempDir()},
+		torrentService:   env.torrentService,
+		providerRegistry: registry,
+		log:              zap.NewNop(),
+		config:           &cfg,
+	}
+
+	return env
+}
+
+func (e *searchTestEnv) downloads() []string {
+	result := make([]string, 0)
+	for _, req := range e.server.Requests() {
+		if strings.HasPrefix(req.URL.Path, "/download/") {
+			result = append(result, req.URL.Path)
+		}
+	}
+	return result
+}
+
+func (e *searchTestEnv) sources() []string {
+	result := make([]string, 0, len(e.torrentService.torrents))
+	for _, torrent := range e.torrentService.torrents {
+		if torrent.Source != nil {
+			result = append(result, *torrent.Source)
+		}
+	}
+	return result
+}
+
+func newTestSeries(id uint, query db.SeriesQuery) db.Series {
+	query.Provider = nyaa.ProviderName
+	queryJson := datatypes.NewJSONType(query)
+	return db.Series{
+		ID:    id,
+		Title: fmt.Sprintf("series %d", id),
+		Query: &queryJson,
+	}
+}
+
+func TestDoPoll(t *testing.T) {
+	ctx := context.Background()
+	existingSeriesId := uint(2)
+	env := newSearchTestEnv(t,
+		[]db.Series{
+			newTestSeries(1, db.SeriesQuery{Include: []string{"jigokuraku", "1080p"}}),
+			newTestSeries(2, db.SeriesQuery{Include: []string{"mashle"}}),
+		},
+		[]db.Torrent{
+			{ID: 100, SeriesId: &existingSeriesId, InfoHash: "00112233445566778899aabbccddeeff00112233"},
+		})
+
+	require.Nil(t, env.service.doPoll(ctx))
+
+	// oldest first, existing info hash is not downloaded at all
+	assert.Equal(t, []string{"/download/1654001.torrent", "/download/1654003.torrent"}, env.downloads())
+	assert.Equal(t, []string{env.server.URL + "/view/1654001", env.server.URL + "/view/1654003"}, env.sources())
+	assert.Equal(t, 3, len(env.torrentService.torrents))
+	assert.Empty(t, env.pendingRssRepo.items)
+
+	feedUrl := env.server.URL + "/rss"
+	last := env.lastRssRepo.entries[nyaa.ProviderName+" "+feedUrl]
+	assert.Equal(t, "1654003", last.RssId)
+	assert.Equal(t, int64(1680967867), last.Timestamp.Unix())
+
+	require.Nil(t, env.service.doPoll(ctx))
+
+	assert.Equal(t, 2, len(env.downloads()))
+	assert.Equal(t, 3, len(env.torrentService.torrents))
+}
+
+func TestDoPollRetriesFailedDownloads(t *testing.T) {
+	ctx := context.Background()
+	env := newSearchTestEnv(t,
+		[]db.Series{
+			newTestSeries(1, db.SeriesQuery{Include: []string{"jigokuraku", "1080p"}}),
+		}, nil)
+	env.failedDownloads["1654003"] = 1
+
+	require.Nil(t, env.service.doPoll(ctx))
+
+	assert.Equal(t, []string{env.server.URL + "/view/1654001"}, env.sources())
+	require.Equal(t, 1, len(env.pendingRssRepo.items))
+	assert.Equal(t, "1654003", env.pendingRssRepo.items[0].RssId)
+
+	// failed item was saved for retry, so cursor is advanced anyway
+	feedUrl := env.server.URL + "/rss"
+	assert.Equal(t, "1654003", env.lastRssRepo.entries[nyaa.ProviderName+" "+feedUrl].RssId)
+
+	require.Nil(t, env.service.doPoll(ctx))
+
+	assert.Equal(t, []string{env.server.URL + "/view/1654001", env.server.URL + "/view/1654003"}, env.sources())
+	assert.Empty(t, env.pendingRssRepo.items)
+}
+
+func TestDoPollDropsPendingAfterRetries(t *testing.T) {
+	ctx := context.Background()
+	env := newSearchTestEnv(t,
+		[]db.Series{
+			newTestSeries(1, db.SeriesQuery{Include: []string{"jigokuraku", "02"}}),
+		}, nil)
+	env.service.config.Search.RssRetries = 2
+	env.failedDownloads["1654003"] = 10
+
+	require.Nil(t, env.service.doPoll(ctx))
+	require.Equal(t, 1, len(env.pendingRssRepo.items))
+
+	require.Nil(t, env.service.doPoll(ctx))
+	require.Equal(t, 1, len(env.pendingRssRepo.items))
+	assert.Equal(t, 1, env.pendingRssRepo.items[0].Attempts)
+
+	require.Nil(t, env.service.doPoll(ctx))
+	assert.Empty(t, env.pendingRssRepo.items)
+	assert.Empty(t, env.torrentService.torrents)
+}
+
+func TestDoPollRetriesUncheckedItems(t *testing.T) {
+	ctx := context.Background()
+	env := newSearchTestEnv(t,
+		[]db.Series{
+			newTestSeries(1, db.SeriesQuery{Include: []string{"jigokuraku", "02"}, SingleFile: true}),
+		}, nil)
+	env.failedViews["1654003"] = 1
+
+	require.Nil(t, env.service.doPoll(ctx))
+
+	// file list is unavailable, so item is neither rejected nor added
+	assert.Empty(t, env.downloads())
+	require.Equal(t, 1, len(env.pendingRssRepo.items))
+	assert.Equal(t, "1654003", env.pendingRssRepo.items[0].RssId)
+
+	require.Nil(t, env.service.doPoll(ctx))
+
+	assert.Equal(t, []string{"/download/1654003.torrent"}, env.downloads())
+	assert.Empty(t, env.pendingRssRepo.items)
+}
+
+func TestRetryPendingSelectsReleases(t *testing.T) {
+	ctx := context.Background()
+	seriesId := uint(1)
+	release := meta.ParseRelease("[SubsPlease] Jigokuraku - 01 (1080p) [A1B2C3D4].mkv")
+	env := newSearchTestEnv(t,
+		[]db.Series{
+			newTestSeries(seriesId, db.SeriesQuery{
+				Include: []string{"jigokuraku"},
+				Scoring: &db.ReleaseScoring{Resolutions: []string{"1080p", "720p"}},
+			}),
+		},
+		[]db.Torrent{
+			{ID: 100, SeriesId: &seriesId, Release: datatypes.NewJSONType(&release)},
+		})
+	env.pendingRssRepo.items = []db.PendingRSSItem{{
+		ID:       1,
+		SeriesId: seriesId,
+		Provider: nyaa.ProviderName,
+		RssId:    "1654002",
+		Title:    "[SubsPlease] Jigokuraku - 01 (720p) [C1D2E3F4].mkv",
+		Link:     env.server.URL + "/view/1654002",
+	}}
+
+	env.service.retryPending(ctx)
+
+	// worse release of already downloaded episode is dropped without downloading
+	assert.Empty(t, env.downloads())
+	assert.Empty(t, env.pendingRssRepo.items)
+	assert.Equal(t, 1, len(env.torrentService.torrents))
+}
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"anileha/config"
+	"anileha/db"
+	"errors"
+	"fmt"
+	torrentLib "github.com/anacrolix/torrent"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"time"
+)
+
+const seedingCheckInterval = 10 * time.Second
+
+func validateSeedingPolicy(policy db.SeedingPolicy) error {
+	switch policy.Mode {
+	case db.SeedingNone, db.SeedingConverted:
+		return nil
+	case db.SeedingRatio:
+		if policy.Ratio <= 0 {
+			return errors.New("seeding ratio must be positive")
+		}
+		return nil
+	case db.SeedingTime:
+		if policy.MinTimeSec <= 0 {
+			return errors.New("seeding time must be positive")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown seeding mode: %s", policy.Mode)
+	}
+}
+
+func globalSeedingPolicy(config *config.Config) db.SeedingPolicy {
+	return db.SeedingPolicy{
+		Mode:       db.SeedingMode(config.Data.Seeding.Mode),
+		Ratio:      config.Data.Seeding.Ratio,
+		MinTimeSec: config.Data.Seeding.MinTimeSec,
+	}
+}
+
+// seedingPolicy Series policy overrides the global one, torrent must be loaded along with its series
+func (s *TorrentService) seedingPolicy(torrent db.Torrent) db.SeedingPolicy {
+	if torrent.Series != nil && torrent.Series.Seeding != nil {
+		return torrent.Series.Seeding.Data()
+	}
+	return globalSeedingPolicy(s.config)
+}
+
+func (s *TorrentService) isSeedingDone(torrent db.Torrent, policy db.SeedingPolicy) (bool, error) {
+	switch policy.Mode {
+	case db.SeedingRatio:
+		return torrent.Ratio() >= policy.Ratio, nil
+	case db.SeedingTime:
+		return seededFor(torrent, policy.MinTimeSec), nil
+	case db.SeedingConverted:
+		if torrent.Status == db.TorrentError {
+			return true, nil
+		}
+		if torrent.Status != db.TorrentReady && torrent.Status != db.TorrentCleaned {
+			return false, nil
+		}
+		conversions, err := s.convertService.GetByTorrentId(torrent.ID)
+		if err != nil {
+			return false, err
+		}
+		// nothing is converted without auto conversion, such torrents are seeded for MinTimeSec,
+		// which leaves time to start a conversion manually
+		if len(conversions) == 0 {
+			return seededFor(torrent, policy.MinTimeSec), nil
+		}
+		for _, conversion := range conversions {
+			if conversion.Status == db.ConversionCreated || conversion.Status == db.ConversionProcessing {
+				return false, nil
+			}
+		}
+		return true, nil
+	default:
+		return true, nil
+	}
+}
+
+// seededFor Checks that torrent was seeded for at least minTimeSec
+func seededFor(torrent db.Torrent, minTimeSec int) bool {
+	if torrent.SeedingSince == nil {
+		return true
+	}
+	return time.Since(*torrent.SeedingSince) >= time.Duration(minTimeSec)*time.Second
+}
+
+// seedingWatcher Keeps publishing and periodically persisting upload totals until seeding policy is satisfied
+// or torrent is closed
+func (s *TorrentService) seedingWatcher(id uint, name string, policy db.SeedingPolicy, uploadedBase uint,
+	cTorrent *torrentLib.Torrent) {
+	ticker := time.NewTicker(seedingCheckInterval)
+	defer ticker.Stop()
+	saveInterval := time.Duration(s.config.Data.ProgressDbSaveSec) * time.Second
+	lastSave := time.Now()
+	for {
+		select {
+		case <-cTorrent.Closed():
+			if err := s.torrentRepo.SetBytesUploaded(id, uploadedBase+sessionBytesUploaded(cTorrent)); err != nil {
+				s.log.Error("failed to update db on torrent upload",
+					zap.Uint("torrentId", id),
+					zap.String("torrentName", name),
+					zap.Error(err))
+			}
+			s.log.Info("seedingWatcher exited",
+				zap.Uint("torrentId", id),
+				zap.String("torrentName", name),
+				zap.String("cause", "closed"))
+			return
+		case <-ticker.C:
+			bytesUploaded := uploadedBase + sessionBytesUploaded(cTorrent)
+			if time.Since(lastSave) >= saveInterval {
+				if err := s.torrentRepo.SetBytesUploaded(id, bytesUploaded); err != nil {
+					s.log.Error("failed to update db on torrent upload",
+						zap.Uint("torrentId", id),
+						zap.String("torrentName", name),
+						zap.Error(err))
+					continue
+				}
+				lastSave = time.Now()
+			}
+
+			torrent, err := s.torrentRepo.GetById(id, false)
+			if err != nil {
+				s.log.Error("failed to get seeding torrent",
+					zap.Uint("torrentId", id),
+					zap.String("torrentName", name),
+					zap.Error(err))
+				continue
+			}
+			if torrent == nil {
+				return
+			}
+			torrent.BytesUploaded = bytesUploaded
+			s.eventService.PublishTorrent(*torrent)
+
+			done, err := s.isSeedingDone(*torrent, policy)
+			if err != nil {
+				s.log.Error("failed to check seeding policy",
+					zap.Uint("torrentId", id),
+					zap.String("torrentName", name),
+					zap.Error(err))
+				continue
+			}
+			if !done {
+				continue
+			}
+
+			s.log.Info("seeding finished",
+				zap.Uint("torrentId", id),
+				zap.String("torrentName", name),
+				zap.String("mode", string(policy.Mode)),
+				zap.Uint("bytesUploaded", bytesUploaded),
+				zap.Float64("ratio", torrent.Ratio()))
+
+			if err := s.torrentRepo.SetBytesUploaded(id, bytesUploaded); err != nil {
+				s.log.Error("failed to update db on torrent upload",
+					zap.Uint("torrentId", id),
+					zap.String("torrentName", name),
+					zap.Error(err))
+			}
+			if err := s.stopSeeding(*torrent); err != nil {
+				s.log.Error("failed to stop seeding",
+					zap.Uint("torrentId", id),
+					zap.String("torrentName", name),
+					zap.Error(err))
+			}
+			return
+		}
+	}
+}
+
+// stopSeeding Drops seeded torrent and removes downloaded copies of its files, ready files are kept
+func (s *TorrentService) stopSeeding(torrent db.Torrent) error {
+	s.dropClientTorrent(torrent.ID)
+
+	s.removeDownloadedFiles(torrent)
+
+	if err := s.torrentRepo.StopSeeding(torrent.ID); err != nil {
+		return err
+	}
+
+	s.publishTorrent(torrent.ID)
+
+	return nil
+}
+
+// resumeSeeding Adds torrents that were seeding before restart back to the client
+func (s *TorrentService) resumeSeeding() {
+	torrents, err := s.torrentRepo.GetSeeding()
+	if err != nil {
+		s.log.Error("failed to get seeding torrents", zap.Error(err))
+		return
+	}
+	for _, torrent := range torrents {
+		policy := s.seedingPolicy(torrent)
+		if policy.Mode == db.SeedingNone {
+			if err := s.stopSeeding(torrent); err != nil {
+				s.log.Error("failed to stop seeding",
+					zap.Uint("torrentId", torrent.ID),
+					zap.String("torrentName", torrent.Name),
+					zap.Error(err))
+			}
+			continue
+		}
+
+		cTorrent, err := s.client.AddTorrentFromFile(torrent.FilePath)
+		if err != nil {
+			s.log.Error("failed to resume seeding",
+				zap.Uint("torrentId", torrent.ID),
+				zap.String("torrentName", torrent.Name),
+				zap.Error(err))
+			continue
+		}
+
+		s.cTorrentMap.Store(torrent.ID, cTorrent)
+
+		<-cTorrent.GotInfo()
+
+		go s.seedingWatcher(torrent.ID, torrent.Name, policy, torrent.BytesUploaded, cTorrent)
+
+		s.log.Info("resumed seeding",
+			zap.Uint("torrentId", torrent.ID),
+			zap.String("torrentName", torrent.Name),
+			zap.String("mode", string(policy.Mode)))
+	}
+}
+
+// linkOrCopy Seeded files have to stay in downloads folder, so ready files are hard links to them when possible
+func linkOrCopy(src string, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dstFile, srcFile); err != nil {
+		_ = dstFile.Close()
+		_ = os.Remove(dst)
+		return err
+	}
+
+	return dstFile.Close()
+}
+
+// sessionBytesUploaded Client stats are not persisted, so they are counted from the moment torrent was added
+func sessionBytesUploaded(cTorrent *torrentLib.Torrent) uint {
+	stats := cTorrent.Stats()
+	return uint(stats.BytesWrittenData.Int64())
+}
@@ -0,0 +1,18 @@
+package service
+
+import (
+	"anileha/db"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSeededFor(t *testing.T) {
+	since := time.Now().Add(-time.Hour)
+	torrent := db.Torrent{SeedingSince: &since}
+
+	assert.True(t, seededFor(torrent, 0))
+	assert.True(t, seededFor(torrent, 3600))
+	assert.False(t, seededFor(torrent, 7200))
+	assert.True(t, seededFor(db.Torrent{}, 7200))
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"anileha/db"
+	"anileha/rest/engine"
+	"fmt"
+	torrentLib "github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/types"
+	"go.uber.org/zap"
+	"golang.org/x/exp/slices"
+	"sync"
+)
+
+// downloadSelection Files of an active download, shared between UpdateSelection and torrentCompletionWatcher
+type downloadSelection struct {
+	mutex     sync.Mutex
+	files     []db.TorrentFile
+	changed   bool // changed selection was updated since the last progress check
+	completed bool // completed selection can't be changed, torrent is being prepared for analysis
+}
+
+func newDownloadSelection(files []db.TorrentFile) *downloadSelection {
+	return &downloadSelection{
+		files:   files,
+		changed: true,
+	}
+}
+
+// check Returns completed and total bytes of selected files, files that are already ready count as completed.
+// Selection is marked completed once all of its files are downloaded
+func (d *downloadSelection) check(cFiles []*torrentLib.File) (uint, uint, bool, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	bytesRead := uint(0)
+	totalLength := uint(0)
+	for _, file := range d.files {
+		if !file.Selected {
+			continue
+		}
+		totalLength += file.Length
+		if file.ReadyPath != nil {
+			bytesRead += file.Length
+		} else {
+			bytesRead += uint(cFiles[file.TorrentIndex].BytesCompleted())
+		}
+	}
+
+	changed := d.changed
+	d.changed = false
+	d.completed = bytesRead >= totalLength
+
+	return bytesRead, totalLength, changed, d.completed
+}
+
+func (d *downloadSelection) fileEvents(torrentId uint, cFiles []*torrentLib.File) []TorrentFileEvent {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	events := make([]TorrentFileEvent, 0, len(d.files))
+	for _, file := range d.files {
+		if !file.Selected || file.ReadyPath != nil {
+			continue
+		}
+		events = append(events, TorrentFileEvent{
+			Id:             file.ID,
+			TorrentId:      torrentId,
+			Status:         db.TorrentFileDownload,
+			Selected:       true,
+			BytesCompleted: uint(cFiles[file.TorrentIndex].BytesCompleted()),
+			Length:         file.Length,
+		})
+	}
+	return events
+}
+
+// filePriority Files that are already ready are not downloaded again
+func filePriority(file db.TorrentFile) types.PiecePriority {
+	if !file.Selected || file.ReadyPath != nil {
+		return torrentLib.PiecePriorityNone
+	}
+	return torrentLib.PiecePriorityNormal
+}
+
+// dropSelection Selection is replaced when torrent is started again, so it is deleted only if it wasn't
+func (s *TorrentService) dropSelection(id uint, selection *downloadSelection) {
+	if current, exists := s.selections.Load(id); exists && current == selection {
+		s.selections.Delete(id)
+	}
+}
+
+// UpdateSelection Adds files to and removes files from an active download without restarting it,
+// only priorities of these files are changed. Selection of a queued torrent is changed in db
+func (s *TorrentService) UpdateSelection(id uint, addIndices []int, removeIndices []int) error {
+	torrent, err := s.torrentRepo.GetById(id, false)
+	if err != nil {
+		return engine.ErrInternal(err.Error())
+	}
+	if torrent == nil {
+		return engine.ErrNotFoundInst
+	}
+
+	for _, index := range append(slices.Clone(addIndices), removeIndices...) {
+		if !slices.ContainsFunc(torrent.Files, func(file db.TorrentFile) bool {
+			return file.ClientIndex == index
+		}) {
+			return engine.ErrBadRequest(fmt.Sprintf("file with index %d not found", index))
+		}
+		if slices.Contains(addIndices, index) && slices.Contains(removeIndices, index) {
+			return engine.ErrBadRequest(fmt.Sprintf("file with index %d is both added and removed", index))
+		}
+	}
+
+	switch torrent.Status {
+	case db.TorrentQueued:
+		err = s.updateQueuedSelection(*torrent, addIndices, removeIndices)
+	case db.TorrentDownload:
+		err = s.updateDownloadSelection(*torrent, addIndices, removeIndices)
+	default:
+		return engine.ErrBadRequest("torrent is not downloading")
+	}
+	if err != nil {
+		return err
+	}
+
+	s.publishTorrent(id)
+
+	s.log.Info("torrent selection updated",
+		zap.Uint("torrentId", torrent.ID),
+		zap.String("torrentName", torrent.Name),
+		zap.Ints("added", addIndices),
+		zap.Ints("removed", removeIndices))
+
+	return nil
+}
+
+// applySelection Updates Selected flags in place, returns ids of files that were actually added and removed
+func applySelection(files []db.TorrentFile, addIndices []int, removeIndices []int) ([]uint, []uint, error) {
+	addedIds := make([]uint, 0, len(addIndices))
+	removedIds := make([]uint, 0, len(removeIndices))
+	selectedCount := 0
+
+	for i := range files {
+		if !files[i].Selected && slices.Contains(addIndices, files[i].ClientIndex) {
+			files[i].Selected = true
+			addedIds = append(addedIds, files[i].ID)
+		} else if files[i].Selected && slices.Contains(removeIndices, files[i].ClientIndex) {
+			files[i].Selected = false
+			removedIds = append(removedIds, files[i].ID)
+		}
+		if files[i].Selected {
+			selectedCount++
+		}
+	}
+
+	if selectedCount == 0 {
+		return nil, nil, engine.ErrBadRequest("no files selected")
+	}
+
+	return addedIds, removedIds, nil
+}
+
+func (s *TorrentService) updateQueuedSelection(torrent db.Torrent, addIndices []int, removeIndices []int) error {
+	s.queueMutex.Lock()
+	defer s.queueMutex.Unlock()
+
+	// torrent could have been started while waiting for the queue
+	current, err := s.torrentRepo.GetById(torrent.ID, false)
+	if err != nil {
+		return engine.ErrInternal(err.Error())
+	}
+	if current == nil || current.Status != db.TorrentQueued {
+		return engine.ErrBadRequest("torrent is not queued anymore")
+	}
+
+	addedIds, removedIds, err := applySelection(torrent.Files, addIndices, removeIndices)
+	if err != nil {
+		return err
+	}
+
+	if err := s.torrentRepo.SetQueuedSelection(addedIds, removedIds); err != nil {
+		return engine.ErrInternal(err.Error())
+	}
+
+	return nil
+}
+
+func (s *TorrentService) updateDownloadSelection(torrent db.Torrent, addIndices []int, removeIndices []int) error {
+	selectionEntry, selectionExists := s.selections.Load(torrent.ID)
+	mapEntry, torrentExists := s.cTorrentMap.Load(torrent.ID)
+	if !selectionExists || !torrentExists {
+		return engine.ErrBadRequest("torrent is not downloading")
+	}
+
+	selection := selectionEntry.(*downloadSelection)
+	cFiles := mapEntry.(*torrentLib.Torrent).Files()
+
+	selection.mutex.Lock()
+	defer selection.mutex.Unlock()
+
+	if selection.completed {
+		return engine.ErrBadRequest("download is already completed")
+	}
+
+	files := slices.Clone(selection.files)
+	addedIds, removedIds, err := applySelection(files, addIndices, removeIndices)
+	if err != nil {
+		return err
+	}
+
+	downloadLength := uint(0)
+	addedLength := int64(0)
+	for i, file := range files {
+		if file.Selected {
+			downloadLength += file.Length
+		}
+		if file.Selected && !selection.files[i].Selected && file.ReadyPath == nil {
+			addedLength += int64(file.Length)
+		}
+	}
+
+	fits, err := s.storageService.Fits(addedLength)
+	if err != nil {
+		return engine.ErrInternal(err.Error())
+	}
+	if !fits {
+		return engine.ErrNotEnoughSpace
+	}
+
+	if err := s.torrentRepo.UpdateSelection(torrent.ID, addedIds, removedIds, downloadLength); err != nil {
+		return engine.ErrInternal(err.Error())
+	}
+
+	for i := range files {
+		if files[i].Selected != selection.files[i].Selected {
+			cFiles[files[i].TorrentIndex].SetPriority(filePriority(files[i]))
+		}
+	}
+
+	selection.files = files
+	selection.changed = true
+
+	return nil
+}
@@ -0,0 +1,27 @@
+package service
+
+import (
+	"anileha/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestApplySelection(t *testing.T) {
+	files := []db.TorrentFile{
+		{ID: 10, ClientIndex: 0, Selected: true},
+		{ID: 11, ClientIndex: 1},
+		{ID: 12, ClientIndex: 2, Selected: true},
+	}
+
+	added, removed, err := applySelection(files, []int{0, 1}, []int{2})
+	require.Nil(t, err)
+	// already selected files are not reported
+	assert.Equal(t, []uint{11}, added)
+	assert.Equal(t, []uint{12}, removed)
+	assert.True(t, files[1].Selected)
+	assert.False(t, files[2].Selected)
+
+	_, _, err = applySelection(files, nil, []int{0, 1})
+	assert.NotNil(t, err)
+}
@@ -4,18 +4,20 @@ import (
 	"anileha/db"
 	"anileha/db/repo"
 	"anileha/rest/engine"
+	"anileha/search"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 )
 
 type SeriesService struct {
-	seriesRepo *repo.SeriesRepo
-	log        *zap.Logger
+	seriesRepo       *repo.SeriesRepo
+	providerRegistry *search.Registry
+	log              *zap.Logger
 }
 
-func NewSeriesService(seriesRepo *repo.SeriesRepo, log *zap.Logger) *SeriesService {
+func NewSeriesService(seriesRepo *repo.SeriesRepo, providerRegistry *search.Registry, log *zap.Logger) *SeriesService {
 	return &SeriesService{
-		seriesRepo, log,
+		seriesRepo, providerRegistry, log,
 	}
 }
 
@@ -66,12 +68,45 @@ func (s *SeriesService) DeleteById(id uint) error {
 }
 
 func (s *SeriesService) SetQuery(id uint, query *db.SeriesQuery) error {
+	if query != nil {
+		provider, err := s.providerRegistry.Get(query.Provider)
+		if err != nil {
+			return engine.ErrBadRequest(err.Error())
+		}
+		if _, err := provider.RSSUrl(queryFeed(query)); err != nil {
+			return engine.ErrBadRequest(err.Error())
+		}
+		if _, err := newQueryMatcher(query); err != nil {
+			return engine.ErrBadRequest(err.Error())
+		}
+	}
 	if err := s.seriesRepo.SetQuery(id, query); err != nil {
 		return engine.ErrInternal(err.Error())
 	}
 	return nil
 }
 
+// SetSeedingPolicy nil policy makes torrents of the series use the global one
+func (s *SeriesService) SetSeedingPolicy(id uint, policy *db.SeedingPolicy) error {
+	if policy != nil {
+		if err := validateSeedingPolicy(*policy); err != nil {
+			return engine.ErrBadRequest(err.Error())
+		}
+	}
+	if err := s.seriesRepo.SetSeedingPolicy(id, policy); err != nil {
+		return engine.ErrInternal(err.Error())
+	}
+	return nil
+}
+
+// SetArchive Sources of archived series are never deleted by retention policy
+func (s *SeriesService) SetArchive(id uint, archive bool) error {
+	if err := s.seriesRepo.SetArchive(id, archive); err != nil {
+		return engine.ErrInternal(err.Error())
+	}
+	return nil
+}
+
 func (s *SeriesService) AddSeries(name string, thumb db.Thumb) (uint, error) {
 	series := db.Series{
 		Title: name,
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"anileha/config"
+	"anileha/db"
+	"anileha/rest/engine"
+	"anileha/util"
+	"context"
+	"fmt"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const storageCheckInterval = 10 * time.Second
+
+var dataSubDirs = []string{
+	util.TempSubDir,
+	util.ThumbSubDir,
+	util.FontSubDir,
+	util.TorrentInfoSubDir,
+	util.TorrentDownloadsSubDir,
+	util.TorrentReadySubDir,
+	util.ConversionSubDir,
+	util.EpisodeSubDir,
+}
+
+type DirUsage struct {
+	Name  string `json:"name"`
+	Bytes int64  `json:"bytes"`
+}
+
+// StorageUsage Disk usage of data subdirectories, hard links of seeded files are counted in both folders
+type StorageUsage struct {
+	TotalBytes    int64      `json:"totalBytes"`
+	FreeBytes     int64      `json:"freeBytes"`
+	ReservedBytes int64      `json:"reservedBytes"`
+	MinFreeBytes  int64      `json:"minFreeBytes"`
+	Dirs          []DirUsage `json:"dirs"`
+}
+
+// StorageService Tracks free space of data dir along with space that active jobs are expected to take
+type StorageService struct {
+	config       *config.Config
+	log          *zap.Logger
+	dataDir      string
+	mutex        sync.Mutex
+	reservations map[string]int64 // reservations Bytes that are yet to be written by active jobs
+}
+
+func NewStorageService(config *config.Config, log *zap.Logger) (*StorageService, error) {
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	dataDir := path.Join(workingDir, config.Data.Dir)
+	err = os.MkdirAll(dataDir, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+	return &StorageService{
+		config:       config,
+		log:          log,
+		dataDir:      dataDir,
+		reservations: make(map[string]int64),
+	}, nil
+}
+
+func torrentReservation(id uint) string {
+	return fmt.Sprintf("torrent:%d", id)
+}
+
+func conversionReservation(id uint) string {
+	return fmt.Sprintf("conversion:%d", id)
+}
+
+// diskSpace Returns total and available bytes of the filesystem that holds data dir
+func (s *StorageService) diskSpace() (int64, int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(s.dataDir, &stat); err != nil {
+		return 0, 0, err
+	}
+	blockSize := int64(stat.Bsize)
+	return int64(stat.Blocks) * blockSize, int64(stat.Bavail) * blockSize, nil
+}
+
+func (s *StorageService) reservedBytes() int64 {
+	reserved := int64(0)
+	for _, bytes := range s.reservations {
+		reserved += bytes
+	}
+	return reserved
+}
+
+// Reserve Sets bytes that the job is yet to write, existing reservation of the job is replaced
+func (s *StorageService) Reserve(key string, bytes int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if bytes <= 0 {
+		delete(s.reservations, key)
+		return
+	}
+	s.reservations[key] = bytes
+}
+
+func (s *StorageService) Release(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.reservations, key)
+}
+
+// Fits Checks that writing bytes on top of all reservations keeps free space above the threshold
+func (s *StorageService) Fits(bytes int64) (bool, error) {
+	_, free, err := s.diskSpace()
+	if err != nil {
+		return false, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return free-s.reservedBytes()-bytes >= s.config.Data.MinFreeBytes, nil
+}
+
+// IsLow Free space is below the threshold right now, reservations are not taken into account
+func (s *StorageService) IsLow() (bool, error) {
+	_, free, err := s.diskSpace()
+	if err != nil {
+		return false, err
+	}
+	return free < s.config.Data.MinFreeBytes, nil
+}
+
+func (s *StorageService) GetUsage() (StorageUsage, error) {
+	total, free, err := s.diskSpace()
+	if err != nil {
+		return StorageUsage{}, engine.ErrInternal(err.Error())
+	}
+
+	dirs := make([]DirUsage, 0, len(dataSubDirs))
+	for _, name := range dataSubDirs {
+		bytes, err := dirSize(path.Join(s.dataDir, name))
+		if err != nil {
+			return StorageUsage{}, engine.ErrInternal(err.Error())
+		}
+		dirs = append(dirs, DirUsage{Name: name, Bytes: bytes})
+	}
+
+	s.mutex.Lock()
+	reserved := s.reservedBytes()
+	s.mutex.Unlock()
+
+	return StorageUsage{
+		TotalBytes:    total,
+		FreeBytes:     free,
+		ReservedBytes: reserved,
+		MinFreeBytes:  s.config.Data.MinFreeBytes,
+		Dirs:          dirs,
+	}, nil
+}
+
+// dirSize Missing dirs are empty, files removed during the walk are skipped
+func dirSize(dir string) (int64, error) {
+	size := int64(0)
+	err := filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+// storageWatcher Pauses downloads while free space is low, starts queued torrents once it is freed
+func (s *TorrentService) storageWatcher(ctx context.Context) {
+	ticker := time.NewTicker(storageCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			low, err := s.storageService.IsLow()
+			if err != nil {
+				s.log.Error("failed to check free space", zap.Error(err))
+				continue
+			}
+
+			s.bandwidth.mutex.Lock()
+			changed := s.bandwidth.downloadsPaused != low
+			s.bandwidth.downloadsPaused = low
+			s.bandwidth.mutex.Unlock()
+
+			if changed && low {
+				s.log.Warn("free space is low, downloads are paused",
+					zap.Int64("minFreeBytes", s.config.Data.MinFreeBytes))
+			}
+			if changed && !low {
+				s.log.Info("free space is available again, downloads are resumed")
+			}
+			if !low {
+				s.processQueue()
+			}
+		}
+	}
+}
+
+// requiredSpace Returns length of selected files, files that are already ready don't need space
+func requiredSpace(torrent db.Torrent) int64 {
+	required := int64(0)
+	for _, file := range torrent.Files {
+		if file.Selected && file.ReadyPath == nil {
+			required += int64(file.Length)
+		}
+	}
+	return required
+}
+
+var StorageExport = fx.Options(fx.Provide(NewStorageService))
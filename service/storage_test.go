@@ -0,0 +1,25 @@
+package service
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirSize(t *testing.T) {
+	dir := t.TempDir()
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "nested"), os.ModePerm))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "a"), make([]byte, 100), 0644))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "nested", "b"), make([]byte, 50), 0644))
+
+	size, err := dirSize(dir)
+	require.Nil(t, err)
+	assert.Equal(t, int64(150), size)
+
+	// missing dirs are empty
+	size, err = dirSize(filepath.Join(dir, "missing"))
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), size)
+}
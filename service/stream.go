@@ -0,0 +1,185 @@
+package service
+
+import (
+	"anileha/db"
+	"anileha/rest/engine"
+	"context"
+	"fmt"
+	torrentLib "github.com/anacrolix/torrent"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const streamReadahead = 16 * 1024 * 1024
+
+// TorrentStream Either already downloaded file on disk or reader of the file that is still downloading
+type TorrentStream struct {
+	Name   string
+	Path   string            // Path is set if the file is ready
+	Reader io.ReadSeekCloser // Reader is set otherwise, it must be closed
+}
+
+// streamReader Reads are cancelled along with the request, closing releases the preview
+type streamReader struct {
+	ctx     context.Context
+	reader  torrentLib.Reader
+	release func()
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	return r.reader.ReadContext(r.ctx, p)
+}
+
+func (r *streamReader) Seek(offset int64, whence int) (int64, error) {
+	return r.reader.Seek(offset, whence)
+}
+
+func (r *streamReader) Close() error {
+	err := r.reader.Close()
+	r.release()
+	return err
+}
+
+// OpenStream Readers prioritize pieces ahead of the read position and block until they are downloaded,
+// so file can be watched while torrent is downloading or even if it is not started at all
+func (s *TorrentService) OpenStream(ctx context.Context, torrentId uint, clientIndex int) (*TorrentStream, error) {
+	torrent, err := s.torrentRepo.GetById(torrentId, false)
+	if err != nil {
+		return nil, engine.ErrInternal(err.Error())
+	}
+	if torrent == nil {
+		return nil, engine.ErrNotFoundInst
+	}
+
+	var file *db.TorrentFile
+	for i := range torrent.Files {
+		if torrent.Files[i].ClientIndex == clientIndex {
+			file = &torrent.Files[i]
+			break
+		}
+	}
+	if file == nil {
+		return nil, engine.ErrBadRequest(fmt.Sprintf("file with index %d not found", clientIndex))
+	}
+
+	name := filepath.Base(file.TorrentPath)
+
+	if file.ReadyPath != nil {
+		if _, err := os.Stat(*file.ReadyPath); err == nil {
+			return &TorrentStream{
+				Name: name,
+				Path: *file.ReadyPath,
+			}, nil
+		}
+	}
+
+	if torrent.Local {
+		return nil, engine.ErrReadyFileNotFound
+	}
+
+	cTorrent, release, err := s.acquirePreview(*torrent)
+	if err != nil {
+		return nil, engine.ErrInternal(err.Error())
+	}
+
+	reader := cTorrent.Files()[file.TorrentIndex].NewReader()
+	reader.SetResponsive()
+	reader.SetReadahead(streamReadahead)
+
+	return &TorrentStream{
+		Name: name,
+		Reader: &streamReader{
+			ctx:     ctx,
+			reader:  reader,
+			release: release,
+		},
+	}, nil
+}
+
+// acquirePreview Returns client torrent, torrents that are not active are added to the client
+// for as long as their files are streamed. Closed handles of stopped torrents are replaced
+func (s *TorrentService) acquirePreview(torrent db.Torrent) (*torrentLib.Torrent, func(), error) {
+	s.previewMutex.Lock()
+	defer s.previewMutex.Unlock()
+
+	var cTorrent *torrentLib.Torrent
+	if mapEntry, exists := s.cTorrentMap.Load(torrent.ID); exists && !isClosed(mapEntry.(*torrentLib.Torrent)) {
+		cTorrent = mapEntry.(*torrentLib.Torrent)
+		if s.previews[cTorrent] == 0 {
+			return cTorrent, func() {}, nil
+		}
+	} else {
+		added, err := s.client.AddTorrentFromFile(torrent.FilePath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to add torrent from file: %w", err)
+		}
+		<-added.GotInfo()
+		s.cTorrentMap.Store(torrent.ID, added)
+		cTorrent = added
+		s.log.Info("started torrent preview",
+			zap.Uint("torrentId", torrent.ID),
+			zap.String("torrentName", torrent.Name))
+	}
+
+	s.previews[cTorrent]++
+
+	return cTorrent, func() {
+		s.releasePreview(torrent.ID, cTorrent)
+	}, nil
+}
+
+// releasePreview Drops previewed torrent after the last stream is closed, unless it was started meanwhile.
+// Queue is locked, so that processQueue can't pick up the handle between the checks and the drop
+func (s *TorrentService) releasePreview(id uint, cTorrent *torrentLib.Torrent) {
+	s.queueMutex.Lock()
+	defer s.queueMutex.Unlock()
+	s.previewMutex.Lock()
+	defer s.previewMutex.Unlock()
+
+	s.previews[cTorrent]--
+	if s.previews[cTorrent] > 0 {
+		return
+	}
+	delete(s.previews, cTorrent)
+
+	if isClosed(cTorrent) {
+		return
+	}
+
+	torrent, err := s.torrentRepo.GetById(id, false)
+	if err != nil {
+		s.log.Error("failed to get previewed torrent",
+			zap.Uint("torrentId", id),
+			zap.Error(err))
+		return
+	}
+	if torrent != nil && (torrent.Status == db.TorrentDownload || torrent.Seeding) {
+		return
+	}
+	// download owns the handle once its selection is stored, even if status is not saved yet
+	if _, downloading := s.selections.Load(id); downloading {
+		return
+	}
+
+	current, exists := s.cTorrentMap.Load(id)
+	if exists && current != cTorrent {
+		return
+	}
+	if exists {
+		s.cTorrentMap.Delete(id)
+	}
+	cTorrent.Drop()
+
+	s.log.Info("stopped torrent preview", zap.Uint("torrentId", id))
+}
+
+func isClosed(cTorrent *torrentLib.Torrent) bool {
+	select {
+	case <-cTorrent.Closed():
+		return true
+	default:
+		return false
+	}
+}
@@ -13,16 +13,18 @@ import (
 	"errors"
 	"fmt"
 	torrentLib "github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 	"golang.org/x/exp/slices"
-	"golang.org/x/time/rate"
 	"gorm.io/datatypes"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -30,12 +32,23 @@ import (
 type TorrentService struct {
 	torrentRepo     *repo.TorrentRepo
 	client          *torrentLib.Client
-	cTorrentMap     sync.Map // cTorrentMap Stores torrentLib.Client torrent entries [uint -> *torrentLib.Torrent]
+	cTorrentMap     sync.Map   // cTorrentMap Stores torrentLib.Client torrent entries [uint -> *torrentLib.Torrent]
+	selections      sync.Map   // selections Stores files of active downloads [uint -> *downloadSelection]
+	queueMutex      sync.Mutex // queueMutex Guards starting of queued torrents
+	verifyMutex     sync.Mutex
+	verifications   map[uint]Verification // verifications State of the last verification of torrents
+	bandwidth       *bandwidthController
+	previewMutex    sync.Mutex
+	previews        map[*torrentLib.Torrent]int // previews Number of open streams of torrents that were added to the client only to be streamed
 	fileService     *FileService
 	analyzer        *analyze.ProbeAnalyzer
 	convertService  *ConversionService
 	fontService     *FontService
+	eventService    *EventService
+	storageService  *StorageService
+	watchRules      []watchRule
 	log             *zap.Logger
+	config          *config.Config
 	infoFolder      string
 	downloadsFolder string
 	readyFolder     string
@@ -76,67 +89,157 @@ func NewTorrentService(
 	analyzer *analyze.ProbeAnalyzer,
 	convertService *ConversionService,
 	fontService *FontService,
+	eventService *EventService,
+	storageService *StorageService,
 ) (*TorrentService, error) {
-	if err := torrentRepo.ResetDownloadStatus(); err != nil {
-		return nil, fmt.Errorf("failed to reset download status: %w", err)
+	if err := torrentRepo.ResetInterruptedStatus(); err != nil {
+		return nil, fmt.Errorf("failed to reset interrupted status: %w", err)
+	}
+	if err := validateSeedingPolicy(globalSeedingPolicy(config)); err != nil {
+		return nil, fmt.Errorf("invalid seeding config: %w", err)
+	}
+	bandwidth, err := newBandwidthController(config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bandwidth schedule: %w", err)
+	}
+	watchRules, err := compileWatchRules(config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid watch rules: %w", err)
 	}
 	infoFolder, downloadsFolder, readyFolder, err := createDirs(config)
 	if err != nil {
 		return nil, err
 	}
+	// piece completion is persisted, so that data of resumed torrents is not downloaded again
+	pieceCompletion, err := storage.NewDefaultPieceCompletionForDir(downloadsFolder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open piece completion db: %w", err)
+	}
+	clientStorage := storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   downloadsFolder,
+		PieceCompletion: pieceCompletion,
+	})
 	clientConfig := torrentLib.NewDefaultClientConfig()
 	clientConfig.DataDir = downloadsFolder
-	downloadRate := rate.Every(time.Second / time.Duration(config.Data.DownloadBpsLimit))
-	uploadRate := rate.Every(time.Second / time.Duration(config.Data.UploadBpsLimit))
-	clientConfig.DownloadRateLimiter = rate.NewLimiter(downloadRate, config.Data.DownloadBpsLimit)
-	clientConfig.UploadRateLimiter = rate.NewLimiter(uploadRate, config.Data.UploadBpsLimit)
+	clientConfig.DefaultStorage = clientStorage
+	clientConfig.DownloadRateLimiter = bandwidth.downloadLimiter
+	clientConfig.UploadRateLimiter = bandwidth.uploadLimiter
 	client, err := torrentLib.NewClient(clientConfig)
 	if err != nil {
+		_ = clientStorage.Close()
 		return nil, err
 	}
 	retainedTorrents := client.Torrents()
 	for _, t := range retainedTorrents {
 		t.Drop()
 	}
-	lifecycle.Append(fx.Hook{
-		OnStop: func(ctx context.Context) error {
-			client.Close()
-			<-client.Closed()
-			return nil
-		},
-	})
-	return &TorrentService{
+	torrentService := &TorrentService{
 		torrentRepo:     torrentRepo,
 		client:          client,
 		fileService:     fileService,
 		analyzer:        analyzer,
 		convertService:  convertService,
 		fontService:     fontService,
+		eventService:    eventService,
+		storageService:  storageService,
+		watchRules:      watchRules,
 		log:             log,
+		config:          config,
 		infoFolder:      infoFolder,
 		downloadsFolder: downloadsFolder,
 		readyFolder:     readyFolder,
-	}, nil
+		bandwidth:       bandwidth,
+		previews:        make(map[*torrentLib.Torrent]int),
+		verifications:   make(map[uint]Verification),
+	}
+	if err := torrentService.loadTorrentCaps(); err != nil {
+		log.Error("failed to load torrent bandwidth caps", zap.Error(err))
+	}
+	watcherCtx, watcherCancel := context.WithCancel(context.Background())
+	lifecycle.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			go torrentService.bandwidthWatcher(watcherCtx)
+			go torrentService.storageWatcher(watcherCtx)
+			go torrentService.retentionWatcher(watcherCtx)
+			if config.Data.Watch.Dir != "" {
+				go torrentService.dirWatcher(watcherCtx)
+			}
+			go func() {
+				torrentService.resumeSeeding()
+				torrentService.resumeDownloads()
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			watcherCancel()
+			client.Close()
+			<-client.Closed()
+			return clientStorage.Close()
+		},
+	})
+	torrentService.fillInfoHashes()
+	return torrentService, nil
+}
+
+// fillInfoHashes Computes info hashes of torrents that were added before hashes were stored
+func (s *TorrentService) fillInfoHashes() {
+	torrents, err := s.torrentRepo.GetWithoutInfoHash()
+	if err != nil {
+		s.log.Error("failed to get torrents without info hash", zap.Error(err))
+		return
+	}
+	for _, torrent := range torrents {
+		infoHash, err := readInfoHash(torrent.FilePath)
+		if err != nil {
+			s.log.Warn("failed to read info hash", zap.Uint("torrentId", torrent.ID), zap.Error(err))
+			continue
+		}
+		err = s.torrentRepo.SetInfoHash(torrent.ID, infoHash)
+		if errors.Is(err, engine.ErrTorrentAlreadyExists) {
+			s.log.Warn("torrent duplicates another one", zap.Uint("torrentId", torrent.ID))
+		} else if err != nil {
+			s.log.Error("failed to set info hash", zap.Uint("torrentId", torrent.ID), zap.Error(err))
+		}
+	}
+}
+
+func readInfoHash(torrentPath string) (string, error) {
+	metaInfo, err := metainfo.LoadFromFile(torrentPath)
+	if err != nil {
+		return "", err
+	}
+	return metaInfo.HashInfoBytes().HexString(), nil
+}
+
+// GetExisting Returns torrent with the same info hash or source if it is already in the library
+func (s *TorrentService) GetExisting(infoHash string, source string) (*db.Torrent, error) {
+	torrent, err := s.torrentRepo.GetExisting(strings.ToLower(infoHash), source)
+	if err != nil {
+		return nil, engine.ErrInternal(err.Error())
+	}
+	return torrent, nil
+}
+
+// dropClientTorrent Drops cTorrent and removes it from the map, so that previews don't get a closed handle.
+// Returns false if torrent wasn't in the client
+func (s *TorrentService) dropClientTorrent(id uint) bool {
+	mapValue, exists := s.cTorrentMap.LoadAndDelete(id)
+	if !exists {
+		return false
+	}
+	cTorrent := mapValue.(*torrentLib.Torrent)
+	cTorrent.Drop()
+	<-cTorrent.Closed()
+	return true
 }
 
 // cleanUpTorrent Drops cTorrent, removes all torrent files
 func (s *TorrentService) cleanUpTorrent(torrent db.Torrent) {
-	mapValue, exists := s.cTorrentMap.LoadAndDelete(torrent.ID)
-
-	if exists {
-		cTorrent := mapValue.(*torrentLib.Torrent)
-		cTorrent.Drop()
-		<-cTorrent.Closed()
-		for _, file := range torrent.Files {
-			cFile := cTorrent.Files()[file.TorrentIndex]
-			var cFilePath string
-			if len(torrent.Files) > 1 {
-				cFilePath = path.Join(s.downloadsFolder, torrent.Name, cFile.DisplayPath())
-			} else {
-				cFilePath = path.Join(s.downloadsFolder, cFile.DisplayPath())
-			}
-			_ = os.RemoveAll(cFilePath)
-		}
+	s.dropClientTorrent(torrent.ID)
+
+	// stopped downloads and previews leave partially downloaded files too
+	if !torrent.Local {
+		s.removeDownloadedFiles(torrent)
 	}
 
 	for _, file := range torrent.Files {
@@ -152,8 +255,24 @@ func (s *TorrentService) cleanUpTorrent(torrent db.Torrent) {
 
 	_ = os.Remove(torrentReadyRootFolder)
 
-	torrentDownloadRootFolder := path.Join(s.downloadsFolder, torrent.Name)
-	_ = os.Remove(torrentDownloadRootFolder)
+	if !torrent.Local {
+		torrentDownloadRootFolder := path.Join(s.downloadsFolder, torrent.Name)
+		_ = os.Remove(torrentDownloadRootFolder)
+	}
+}
+
+// removeDownloadedFiles Removes files of the torrent from downloads folder, cTorrent must be dropped beforehand
+func (s *TorrentService) removeDownloadedFiles(torrent db.Torrent) {
+	for _, file := range torrent.Files {
+		var filePath string
+		if len(torrent.Files) > 1 {
+			filePath = path.Join(s.downloadsFolder, torrent.Name, file.TorrentPath)
+		} else {
+			filePath = path.Join(s.downloadsFolder, file.TorrentPath)
+		}
+		_ = os.RemoveAll(filePath)
+	}
+	_ = os.Remove(path.Join(s.downloadsFolder, torrent.Name))
 }
 
 func (s *TorrentService) GetById(id uint) (*db.Torrent, error) {
@@ -178,6 +297,19 @@ func (s *TorrentService) GetByIdWithSeries(id uint) (*db.Torrent, error) {
 	return torrent, nil
 }
 
+// publishTorrent Publishes current state of the torrent and its files, called after state changes
+func (s *TorrentService) publishTorrent(id uint) {
+	torrent, err := s.torrentRepo.GetById(id, false)
+	if err != nil || torrent == nil {
+		s.log.Warn("failed to get torrent for event",
+			zap.Uint("torrentId", id),
+			zap.Error(err))
+		return
+	}
+	s.eventService.PublishTorrent(*torrent)
+	s.eventService.PublishTorrentFiles(*torrent)
+}
+
 func (s *TorrentService) GetAll() ([]db.Torrent, error) {
 	torrentArr, err := s.torrentRepo.GetAll()
 	if err != nil {
@@ -203,7 +335,7 @@ func (s *TorrentService) DeleteById(id uint) error {
 		return engine.ErrNotFoundInst
 	}
 
-	if torrent.Status == db.TorrentDownload {
+	if torrent.Status == db.TorrentDownload || torrent.Status == db.TorrentQueued {
 		err := s.Stop(*torrent)
 		if err != nil {
 			return engine.ErrInternal(err.Error())
@@ -215,6 +347,8 @@ func (s *TorrentService) DeleteById(id uint) error {
 		return engine.ErrInternal(err.Error())
 	}
 
+	s.eventService.Publish(EventTorrent, TorrentEvent{Id: id, Status: torrent.Status, Deleted: true})
+
 	go s.cleanUpTorrent(*torrent)
 
 	return nil
@@ -235,8 +369,9 @@ func (s *TorrentService) onFailedImport(torrent db.Torrent, err error) {
 	s.cleanUpTorrent(torrent)
 }
 
-// prepareForAnalysis Creates READY folder, moves torrent files into it, updates DB entries
-func (s *TorrentService) prepareForAnalysis(id uint) {
+// prepareForAnalysis Creates READY folder, moves torrent files into it, updates DB entries.
+// Files of seeded torrents are kept in downloads folder, ready files are linked or copied instead
+func (s *TorrentService) prepareForAnalysis(id uint, keepDownloaded bool) {
 	torrent, err := s.torrentRepo.GetById(id, false)
 	if err != nil {
 		s.log.Error("failed to complete torrent",
@@ -269,7 +404,9 @@ func (s *TorrentService) prepareForAnalysis(id uint) {
 
 		// if file is not selected - delete it and continue
 		if !torrent.Files[i].Selected {
-			_ = os.Remove(oldPath)
+			if !keepDownloaded {
+				_ = os.Remove(oldPath)
+			}
 			continue
 		}
 
@@ -294,7 +431,11 @@ func (s *TorrentService) prepareForAnalysis(id uint) {
 			return
 		}
 
-		err = os.Rename(oldPath, newPath)
+		if keepDownloaded {
+			err = linkOrCopy(oldPath, newPath)
+		} else {
+			err = os.Rename(oldPath, newPath)
+		}
 		if err != nil {
 			s.log.Error("failed to move ready torrent file",
 				zap.Uint("torrentId", torrent.ID),
@@ -318,6 +459,8 @@ func (s *TorrentService) prepareForAnalysis(id uint) {
 		return
 	}
 
+	s.publishTorrent(torrent.ID)
+
 	s.log.Info("torrent prepared for analysis",
 		zap.Uint("torrentId", torrent.ID),
 		zap.String("torrentName", torrent.Name))
@@ -404,6 +547,8 @@ func (s *TorrentService) performAnalysis(id uint, etaCalc *util.EtaCalculator) {
 				zap.Error(err))
 			return
 		}
+		torrent.Progress = progress
+		s.eventService.PublishTorrent(*torrent)
 	}
 
 	err = s.torrentRepo.SetReady(*torrent)
@@ -415,6 +560,8 @@ func (s *TorrentService) performAnalysis(id uint, etaCalc *util.EtaCalculator) {
 		return
 	}
 
+	s.publishTorrent(id)
+
 	if torrent.Auto.Data() != nil {
 		go s.startAutoConvert(id)
 	}
@@ -483,55 +630,127 @@ func (s *TorrentService) startAutoConvert(id uint) {
 	}
 }
 
-// torrentCompletionWatcher Polls for torrent's completion, calls prepareForAnalysis
-func (s *TorrentService) torrentCompletionWatcher(id uint, name string, files []db.TorrentFile,
-	totalDownloadLength uint, cTorrent *torrentLib.Torrent) {
-	ticker := time.NewTicker(3 * time.Second)
+// torrentCompletionWatcher Polls for torrent's completion, calls prepareForAnalysis, then seeds torrent
+// if seeding policy requires it. Progress is published on every tick, but saved to db less often
+func (s *TorrentService) torrentCompletionWatcher(id uint, name string, selection *downloadSelection,
+	uploadedBase uint, cTorrent *torrentLib.Torrent) {
+	defer s.dropSelection(id, selection)
+	defer s.storageService.Release(torrentReservation(id))
+	ticker := time.NewTicker(progressEventInterval)
 	defer ticker.Stop()
+	saveInterval := time.Duration(s.config.Data.ProgressDbSaveSec) * time.Second
+	lastSave := time.Now()
+	saved := true
+	var progress util.Progress
+	var bytesRead, bytesUploaded uint
+	saveProgress := func() {
+		lastSave = time.Now()
+		saved = true
+		if err := s.torrentRepo.UpdateProgressAndBytes(id, progress, bytesRead, bytesUploaded); err != nil {
+			s.log.Error("failed to update db on torrent progress",
+				zap.Uint("torrentId", id),
+				zap.String("torrentName", name),
+				zap.Error(err))
+		}
+	}
 	cFiles := cTorrent.Files()
-	etaCalc := util.NewEtaCalculator(0, float64(totalDownloadLength))
+	etaCalc := util.NewEtaCalculator(0, 0)
 	etaCalc.Start()
 	for {
 		select {
 		case <-cTorrent.Closed():
+			// progress since the last save would be lost otherwise
+			if !saved {
+				saveProgress()
+			}
 			s.log.Info("torrentCompletionWatcher exited",
 				zap.Uint("torrentId", id),
 				zap.String("torrentName", name),
 				zap.String("cause", "closed"))
 			return
 		case <-ticker.C:
-			bytesRead := uint(0)
-			for _, file := range files {
-				if file.Selected {
-					cFile := cFiles[file.TorrentIndex]
-					bytesRead += uint(cFile.BytesCompleted())
-				}
+			var totalLength uint
+			var changed, completed bool
+			bytesRead, totalLength, changed, completed = selection.check(cFiles)
+			bytesUploaded = uploadedBase + sessionBytesUploaded(cTorrent)
+			s.storageService.Reserve(torrentReservation(id), int64(totalLength)-int64(bytesRead))
+			// ready files and files added on the fly must not affect speed
+			if changed {
+				etaCalc.Rebase(float64(bytesRead), float64(totalLength))
+			} else {
+				etaCalc.Update(float64(bytesRead))
 			}
-			etaCalc.Update(float64(bytesRead))
-			progress := etaCalc.GetProgress()
-			go func() {
-				if err := s.torrentRepo.UpdateProgressAndBytesRead(id, progress, bytesRead); err != nil {
-					s.log.Error("failed to update db on torrent progress",
-						zap.Uint("torrentId", id),
-						zap.String("torrentName", name),
-						zap.Error(err))
-				}
-			}()
-			if bytesRead < totalDownloadLength {
+			progress = etaCalc.GetProgress()
+			saved = false
+
+			s.eventService.PublishTorrent(db.Torrent{
+				ID:            id,
+				Status:        db.TorrentDownload,
+				Progress:      progress,
+				BytesRead:     bytesRead,
+				BytesUploaded: bytesUploaded,
+			})
+			for _, event := range selection.fileEvents(id, cFiles) {
+				s.eventService.Publish(EventTorrentFile, event)
+			}
+
+			if completed || time.Since(lastSave) >= saveInterval {
+				saveProgress()
+			}
+			if !completed {
 				continue
 			}
 
-			cTorrent.Drop()
-			s.cTorrentMap.Delete(id)
-			<-cTorrent.Closed()
+			policy := s.completedSeedingPolicy(id, name)
+			if policy.Mode == db.SeedingNone {
+				cTorrent.Drop()
+				s.cTorrentMap.Delete(id)
+				<-cTorrent.Closed()
+
+				s.prepareForAnalysis(id, false)
+				go s.processQueue()
+				s.performAnalysis(id, etaCalc)
+				return
+			}
 
-			s.prepareForAnalysis(id)
+			s.prepareForAnalysis(id, true)
+			go s.processQueue()
 			s.performAnalysis(id, etaCalc)
+			s.seedingWatcher(id, name, policy, uploadedBase, cTorrent)
 			return
 		}
 	}
 }
 
+// completedSeedingPolicy Marks completed torrent as seeding unless its policy is SeedingNone
+func (s *TorrentService) completedSeedingPolicy(id uint, name string) db.SeedingPolicy {
+	torrent, err := s.torrentRepo.GetById(id, true)
+	if err != nil || torrent == nil {
+		s.log.Error("failed to get seeding policy",
+			zap.Uint("torrentId", id),
+			zap.String("torrentName", name),
+			zap.Error(err))
+		return db.SeedingPolicy{Mode: db.SeedingNone}
+	}
+	policy := s.seedingPolicy(*torrent)
+	if policy.Mode == db.SeedingNone {
+		return policy
+	}
+	if err := s.torrentRepo.StartSeeding(id); err != nil {
+		s.log.Error("failed to start seeding",
+			zap.Uint("torrentId", id),
+			zap.String("torrentName", name),
+			zap.Error(err))
+		return db.SeedingPolicy{Mode: db.SeedingNone}
+	}
+	s.publishTorrent(id)
+	s.log.Info("torrent completed, seeding",
+		zap.Uint("torrentId", id),
+		zap.String("torrentName", name),
+		zap.String("mode", string(policy.Mode)))
+	return policy
+}
+
 func (s *TorrentService) initTorrent(torrent db.Torrent) error {
 	cTorrent, err := s.client.AddTorrentFromFile(torrent.FilePath)
 	if err != nil {
@@ -597,6 +816,8 @@ func (s *TorrentService) initTorrent(torrent db.Torrent) error {
 	s.cTorrentMap.Delete(torrent.ID)
 	<-cTorrent.Closed()
 
+	s.publishTorrent(torrent.ID)
+
 	if torrent.Auto.Data() != nil {
 		go s.startAutoDownload(torrent.ID)
 	}
@@ -607,19 +828,43 @@ func (s *TorrentService) initTorrent(torrent db.Torrent) error {
 	return nil
 }
 
-func (s *TorrentService) AddFromFile(seriesId uint, tempPath string, auto *db.AutoTorrent) error {
+// AddFromFile Returns id of the new torrent, or id of the existing one along with engine.ErrTorrentAlreadyExists
+// if torrent with the same info hash or source was already added
+func (s *TorrentService) AddFromFile(seriesId uint, tempPath string, auto *db.AutoTorrent,
+	release *meta.ReleaseInfo, source *string) (uint, error) {
+	infoHash, err := readInfoHash(tempPath)
+	if err != nil {
+		return 0, engine.ErrBadRequest(fmt.Sprintf("invalid torrent file: %s", err.Error()))
+	}
+	var sourceStr string
+	if source != nil {
+		sourceStr = *source
+	}
+	existing, err := s.GetExisting(infoHash, sourceStr)
+	if err != nil {
+		return 0, err
+	}
+	if existing != nil {
+		s.log.Info("torrent already exists",
+			zap.Uint("torrentId", existing.ID),
+			zap.String("infoHash", infoHash))
+		return existing.ID, engine.ErrTorrentAlreadyExists
+	}
 	newPath, err := s.fileService.GenFilePath(s.infoFolder, tempPath)
 	if err != nil {
-		return engine.ErrInternal(err.Error())
+		return 0, engine.ErrInternal(err.Error())
 	}
 	err = os.Rename(tempPath, newPath)
 	if err != nil {
-		return engine.ErrInternal(err.Error())
+		return 0, engine.ErrInternal(err.Error())
 	}
 	torrent := db.Torrent{
 		SeriesId: &seriesId,
 		FilePath: newPath,
+		InfoHash: infoHash,
+		Source:   source,
 		Auto:     datatypes.NewJSONType(auto),
+		Release:  datatypes.NewJSONType(release),
 	}
 	_, err = s.torrentRepo.Create(&torrent)
 	if err != nil {
@@ -627,7 +872,15 @@ func (s *TorrentService) AddFromFile(seriesId uint, tempPath string, auto *db.Au
 		if deleteErr != nil {
 			s.log.Warn("error deleting torrent on add error", zap.Error(deleteErr))
 		}
-		return engine.ErrInternal(err.Error())
+		// the same torrent was added concurrently after the check above
+		if errors.Is(err, engine.ErrTorrentAlreadyExists) {
+			existing, _ := s.GetExisting(infoHash, "")
+			if existing != nil {
+				return existing.ID, err
+			}
+			return 0, err
+		}
+		return 0, engine.ErrInternal(err.Error())
 	}
 	s.log.Info("adding new torrent in the background",
 		zap.Uint("seriesId", seriesId),
@@ -638,17 +891,89 @@ func (s *TorrentService) AddFromFile(seriesId uint, tempPath string, auto *db.Au
 			s.log.Error("failed to init torrent", zap.Error(err))
 		}
 	}()
-	return nil
+	return torrent.ID, nil
+}
+
+// resolveMagnet Waits for magnet metadata, saves it as a .torrent file into temp dir.
+// Client may already hold the torrent, e.g. for preview, such handle is reused and left as is
+func (s *TorrentService) resolveMagnet(ctx context.Context, magnetUri string) (string, error) {
+	spec, err := torrentLib.TorrentSpecFromMagnetUri(magnetUri)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse magnet: %w", err)
+	}
+	cTorrent, created, err := s.client.AddTorrentSpec(spec)
+	if err != nil {
+		return "", fmt.Errorf("failed to add magnet: %w", err)
+	}
+	if created {
+		defer func() {
+			cTorrent.Drop()
+			<-cTorrent.Closed()
+		}()
+	}
+
+	timeout := time.NewTimer(time.Duration(s.config.Data.MagnetTimeoutSec) * time.Second)
+	defer timeout.Stop()
+
+	select {
+	case <-cTorrent.GotInfo():
+	case <-cTorrent.Closed():
+		return "", fmt.Errorf("torrent closed while waiting for metadata")
+	case <-timeout.C:
+		return "", fmt.Errorf("timed out waiting for metadata")
+	case <-ctx.Done():
+		return "", fmt.Errorf("cancelled waiting for metadata: %w", ctx.Err())
+	}
+
+	tempDst, err := s.fileService.GenTempFilePath("new.torrent")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+
+	file, err := os.Create(tempDst)
+	if err != nil {
+		return "", fmt.Errorf("failed to create torrent file: %w", err)
+	}
+
+	err = cTorrent.Metainfo().Write(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		s.fileService.DeleteTempFileAsync(tempDst)
+		return "", fmt.Errorf("failed to write torrent file: %w", err)
+	}
+
+	return tempDst, nil
 }
 
-func (s *TorrentService) Start(torrent db.Torrent, fileIndices []int) error {
-	mapEntry, exists := s.cTorrentMap.Load(torrent.ID)
-	if exists {
-		cTorrent := mapEntry.(*torrentLib.Torrent)
-		cTorrent.Drop()
-		<-cTorrent.Closed()
+// AddFromMagnet Waits up to MagnetTimeoutSec for magnet metadata, then adds torrent the same way as AddFromFile
+func (s *TorrentService) AddFromMagnet(ctx context.Context, seriesId uint, magnetUri string,
+	auto *db.AutoTorrent) (uint, error) {
+	magnet, err := metainfo.ParseMagnetUri(magnetUri)
+	if err != nil {
+		return 0, engine.ErrBadRequest(fmt.Sprintf("invalid magnet uri: %s", err.Error()))
+	}
+	existing, err := s.GetExisting(magnet.InfoHash.HexString(), "")
+	if err != nil {
+		return 0, err
 	}
+	if existing != nil {
+		return existing.ID, engine.ErrTorrentAlreadyExists
+	}
+	s.log.Info("waiting for magnet metadata",
+		zap.Uint("seriesId", seriesId),
+		zap.String("infoHash", magnet.InfoHash.HexString()))
+	tempDst, err := s.resolveMagnet(ctx, magnetUri)
+	if err != nil {
+		return 0, engine.ErrInternal(fmt.Sprintf("failed to resolve magnet: %s", err.Error()))
+	}
+	defer s.fileService.DeleteTempFileAsync(tempDst)
+	return s.AddFromFile(seriesId, tempDst, auto, nil, nil)
+}
 
+// startDownload Adds torrent to the client and starts downloading selected files, called by processQueue
+func (s *TorrentService) startDownload(torrent db.Torrent, fileIndices []int) error {
 	cTorrent, err := s.client.AddTorrentFromFile(torrent.FilePath)
 	if err != nil {
 		return engine.ErrInternal(fmt.Sprintf("failed to add torrent from file: %s", err.Error()))
@@ -660,25 +985,18 @@ func (s *TorrentService) Start(torrent db.Torrent, fileIndices []int) error {
 
 	downloadLength := uint(0)
 
-	for i := range torrent.Files {
-		cFile := cTorrent.Files()[torrent.Files[i].TorrentIndex]
-		cFile.SetPriority(torrentLib.PiecePriorityNone)
-		torrent.Files[i].Selected = false
-		torrent.Files[i].Status = db.TorrentFileIdle
-	}
-
 	unselectedFiles := make([]uint, 0, len(torrent.Files))
 	selectedFiles := make([]uint, 0, len(torrent.Files))
 
 	for i := range torrent.Files {
-		if fileIndices == nil || slices.Contains(fileIndices, torrent.Files[i].ClientIndex) {
-			cFile := cTorrent.Files()[torrent.Files[i].TorrentIndex]
+		torrent.Files[i].Selected = fileIndices == nil || slices.Contains(fileIndices, torrent.Files[i].ClientIndex)
 
-			cFile.SetPriority(torrentLib.PiecePriorityNormal)
+		// files that are already ready stay selected, but are not downloaded again
+		cFile := cTorrent.Files()[torrent.Files[i].TorrentIndex]
+		cFile.SetPriority(filePriority(torrent.Files[i]))
 
-			downloadLength += uint(cFile.Length())
-			torrent.Files[i].Selected = true
-			torrent.Files[i].Status = db.TorrentFileDownload
+		if torrent.Files[i].Selected {
+			downloadLength += torrent.Files[i].Length
 			selectedFiles = append(selectedFiles, torrent.Files[i].ID)
 		} else {
 			unselectedFiles = append(unselectedFiles, torrent.Files[i].ID)
@@ -690,32 +1008,47 @@ func (s *TorrentService) Start(torrent db.Torrent, fileIndices []int) error {
 		return engine.ErrInternal(err.Error())
 	}
 
-	go s.torrentCompletionWatcher(torrent.ID, torrent.Name, torrent.Files, downloadLength, cTorrent)
+	selection := newDownloadSelection(torrent.Files)
+	s.selections.Store(torrent.ID, selection)
+
+	s.publishTorrent(torrent.ID)
+
+	go s.torrentCompletionWatcher(torrent.ID, torrent.Name, selection, torrent.BytesUploaded, cTorrent)
 
 	return nil
 }
 
 func (s *TorrentService) Stop(torrent db.Torrent) error {
-	mapEntry, exists := s.cTorrentMap.Load(torrent.ID)
-	if !exists {
-		return engine.ErrNotFoundInst
+	if torrent.Status == db.TorrentQueued {
+		if err := s.torrentRepo.StopTorrent(torrent.ID); err != nil {
+			return err
+		}
+		s.publishTorrent(torrent.ID)
+		return nil
 	}
 
-	cTorrent := mapEntry.(*torrentLib.Torrent)
+	if torrent.Seeding && torrent.Status != db.TorrentDownload {
+		return s.stopSeeding(torrent)
+	}
 
 	for i := range torrent.Files {
 		torrent.Files[i].Selected = false
 		torrent.Files[i].Status = db.TorrentFileIdle
 	}
 
-	cTorrent.Drop()
-	<-cTorrent.Closed()
+	if !s.dropClientTorrent(torrent.ID) {
+		return engine.ErrNotFoundInst
+	}
 
 	err := s.torrentRepo.StopTorrent(torrent.ID)
 	if err != nil {
 		return err
 	}
 
+	s.publishTorrent(torrent.ID)
+
+	go s.processQueue()
+
 	return nil
 }
 
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"anileha/db"
+	"anileha/rest/engine"
+	"anileha/util"
+	"errors"
+	torrentLib "github.com/anacrolix/torrent"
+	"go.uber.org/zap"
+	"golang.org/x/exp/slices"
+	"time"
+)
+
+// VerificationResult Valid data of the verified files, ready files are not verified
+type VerificationResult struct {
+	TotalBytes   uint `json:"totalBytes"`
+	ValidBytes   uint `json:"validBytes"`
+	ValidPercent int  `json:"validPercent"`
+	Complete     bool `json:"complete"`
+}
+
+type VerificationStatus string
+
+const (
+	VerificationRunning VerificationStatus = "running"
+	VerificationDone    VerificationStatus = "done"
+	VerificationError   VerificationStatus = "error"
+)
+
+// Verification State of the last verification of a torrent, published as EventVerification on every change
+type Verification struct {
+	TorrentId uint                `json:"torrentId"`
+	Status    VerificationStatus  `json:"status"`
+	Progress  int                 `json:"progress"` // Progress percent of hashed pieces
+	Result    *VerificationResult `json:"result"`
+	Error     string              `json:"error"`
+}
+
+func (s *TorrentService) setVerification(verification Verification) {
+	s.verifyMutex.Lock()
+	s.verifications[verification.TorrentId] = verification
+	s.verifyMutex.Unlock()
+	s.eventService.Publish(EventVerification, verification)
+}
+
+// GetVerification Returns state of the last verification of the torrent since restart
+func (s *TorrentService) GetVerification(id uint) (Verification, error) {
+	s.verifyMutex.Lock()
+	defer s.verifyMutex.Unlock()
+	verification, exists := s.verifications[id]
+	if !exists {
+		return Verification{}, engine.ErrNotFoundInst
+	}
+	return verification, nil
+}
+
+// Verify Re-hashes pieces of selected files that are not ready yet in the background, all such files are verified
+// if none is selected and torrent never finished. Missing and corrupt pieces are downloaded again,
+// complete data goes straight to analysis
+func (s *TorrentService) Verify(id uint) (Verification, error) {
+	torrent, err := s.torrentRepo.GetById(id, false)
+	if err != nil {
+		return Verification{}, engine.ErrInternal(err.Error())
+	}
+	if torrent == nil {
+		return Verification{}, engine.ErrNotFoundInst
+	}
+	if torrent.Local {
+		return Verification{}, engine.ErrBadRequest("local torrent has nothing to verify against")
+	}
+	if torrent.Status == db.TorrentCreating || torrent.Status == db.TorrentAnalysis {
+		return Verification{}, engine.ErrBadRequest("torrent is busy")
+	}
+
+	files := verifiedFiles(*torrent)
+	if len(files) == 0 {
+		return Verification{}, engine.ErrBadRequest("nothing to verify, all selected files are ready")
+	}
+
+	verification := Verification{
+		TorrentId: id,
+		Status:    VerificationRunning,
+	}
+
+	s.verifyMutex.Lock()
+	if s.verifications[id].Status == VerificationRunning {
+		s.verifyMutex.Unlock()
+		return Verification{}, engine.ErrBadRequest("torrent is already being verified")
+	}
+	s.verifications[id] = verification
+	s.verifyMutex.Unlock()
+
+	s.eventService.Publish(EventVerification, verification)
+
+	go s.runVerification(*torrent, files)
+
+	return verification, nil
+}
+
+func (s *TorrentService) runVerification(torrent db.Torrent, files []db.TorrentFile) {
+	fail := func(err error) {
+		s.log.Error("failed to verify torrent data",
+			zap.Uint("torrentId", torrent.ID),
+			zap.String("torrentName", torrent.Name),
+			zap.Error(err))
+		s.setVerification(Verification{
+			TorrentId: torrent.ID,
+			Status:    VerificationError,
+			Error:     err.Error(),
+		})
+	}
+
+	cTorrent, release, err := s.acquirePreview(torrent)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	s.log.Info("verifying torrent data",
+		zap.Uint("torrentId", torrent.ID),
+		zap.String("torrentName", torrent.Name),
+		zap.Int("fileCount", len(files)))
+
+	lastPublish := time.Now()
+	result, err := verifyFiles(cTorrent, files, func(progress int) {
+		if time.Since(lastPublish) < progressEventInterval {
+			return
+		}
+		lastPublish = time.Now()
+		s.setVerification(Verification{
+			TorrentId: torrent.ID,
+			Status:    VerificationRunning,
+			Progress:  progress,
+		})
+	})
+
+	release()
+
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	s.log.Info("torrent data verified",
+		zap.Uint("torrentId", torrent.ID),
+		zap.String("torrentName", torrent.Name),
+		zap.Uint("validBytes", result.ValidBytes),
+		zap.Uint("totalBytes", result.TotalBytes))
+
+	if err := s.continueAfterVerification(torrent, files, result); err != nil {
+		fail(err)
+		return
+	}
+
+	s.setVerification(Verification{
+		TorrentId: torrent.ID,
+		Status:    VerificationDone,
+		Progress:  100,
+		Result:    &result,
+	})
+}
+
+// verifiedFiles Torrents that finished downloading once only verify files that are still selected,
+// so that files skipped on purpose are not downloaded again
+func verifiedFiles(torrent db.Torrent) []db.TorrentFile {
+	files := make([]db.TorrentFile, 0, len(torrent.Files))
+	for _, file := range torrent.Files {
+		if file.Selected && file.ReadyPath == nil {
+			files = append(files, file)
+		}
+	}
+	if len(files) > 0 || torrent.Seeding || torrent.Status == db.TorrentReady || torrent.Status == db.TorrentCleaned {
+		return files
+	}
+	for _, file := range torrent.Files {
+		if file.ReadyPath == nil {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// verifyFiles Hashes pieces of the files one by one, so that the client keeps serving other torrents,
+// onProgress is called with percent of hashed pieces after every piece
+func verifyFiles(cTorrent *torrentLib.Torrent, files []db.TorrentFile,
+	onProgress func(progress int)) (VerificationResult, error) {
+	cFiles := cTorrent.Files()
+
+	pieces := make([]int, 0)
+	visited := make(map[int]struct{})
+	for _, file := range files {
+		cFile := cFiles[file.TorrentIndex]
+		for i := cFile.BeginPieceIndex(); i < cFile.EndPieceIndex(); i++ {
+			if _, exists := visited[i]; exists {
+				continue
+			}
+			visited[i] = struct{}{}
+			pieces = append(pieces, i)
+		}
+	}
+
+	for index, piece := range pieces {
+		select {
+		case <-cTorrent.Closed():
+			return VerificationResult{}, errors.New("torrent was closed during verification")
+		default:
+		}
+		cTorrent.Piece(piece).VerifyData()
+		onProgress(100 * (index + 1) / len(pieces))
+	}
+
+	result := VerificationResult{}
+	for _, file := range files {
+		result.TotalBytes += file.Length
+		result.ValidBytes += uint(cFiles[file.TorrentIndex].BytesCompleted())
+	}
+	result.Complete = result.ValidBytes >= result.TotalBytes
+	if result.TotalBytes > 0 {
+		result.ValidPercent = int(100 * float64(result.ValidBytes) / float64(result.TotalBytes))
+	} else {
+		result.ValidPercent = 100
+	}
+
+	return result, nil
+}
+
+// continueAfterVerification Active downloads pick up verified pieces by themselves,
+// other torrents are either queued again or analyzed right away
+func (s *TorrentService) continueAfterVerification(torrent db.Torrent, files []db.TorrentFile,
+	result VerificationResult) error {
+	if torrent.Status == db.TorrentDownload {
+		if selectionEntry, exists := s.selections.Load(torrent.ID); exists {
+			selection := selectionEntry.(*downloadSelection)
+			selection.mutex.Lock()
+			selection.changed = true
+			selection.mutex.Unlock()
+		}
+		return nil
+	}
+
+	fileIndices := make([]int, 0, len(files))
+	for _, file := range files {
+		fileIndices = append(fileIndices, file.ClientIndex)
+	}
+
+	if !result.Complete {
+		return s.Start(torrent, fileIndices)
+	}
+
+	// seeded torrent keeps seeding, files can be selected with Start
+	if torrent.Seeding {
+		return nil
+	}
+
+	go s.analyzeVerified(torrent, fileIndices)
+
+	return nil
+}
+
+// analyzeVerified Marks verified files as selected and passes them to analysis as if they were just downloaded
+func (s *TorrentService) analyzeVerified(torrent db.Torrent, fileIndices []int) {
+	unselectedFiles := make([]uint, 0, len(torrent.Files))
+	selectedFiles := make([]uint, 0, len(torrent.Files))
+	downloadLength := uint(0)
+	for _, file := range torrent.Files {
+		if slices.Contains(fileIndices, file.ClientIndex) {
+			selectedFiles = append(selectedFiles, file.ID)
+			downloadLength += file.Length
+		} else {
+			unselectedFiles = append(unselectedFiles, file.ID)
+		}
+	}
+
+	if err := s.torrentRepo.StartTorrent(torrent.ID, unselectedFiles, selectedFiles, downloadLength); err != nil {
+		s.log.Error("failed to select verified files",
+			zap.Uint("torrentId", torrent.ID),
+			zap.String("torrentName", torrent.Name),
+			zap.Error(err))
+		return
+	}
+
+	etaCalc := util.NewEtaCalculator(0, float64(downloadLength))
+	etaCalc.Start()
+
+	s.prepareForAnalysis(torrent.ID, false)
+	s.performAnalysis(torrent.ID, etaCalc)
+}
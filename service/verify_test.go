@@ -0,0 +1,120 @@
+package service
+
+import (
+	"anileha/db"
+	"bytes"
+	torrentLib "github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func verifiedFileIds(torrent db.Torrent) []uint {
+	ids := make([]uint, 0)
+	for _, file := range verifiedFiles(torrent) {
+		ids = append(ids, file.ID)
+	}
+	return ids
+}
+
+func TestVerifiedFiles(t *testing.T) {
+	readyPath := "/ready/1/01.mkv"
+	files := []db.TorrentFile{
+		{ID: 1, Selected: true, ReadyPath: &readyPath},
+		{ID: 2, Selected: true},
+		{ID: 3},
+	}
+	unselected := []db.TorrentFile{
+		{ID: 1, Selected: true, ReadyPath: &readyPath},
+		{ID: 3},
+	}
+
+	assert.Equal(t, []uint{2}, verifiedFileIds(db.Torrent{Status: db.TorrentIdle, Files: files}))
+
+	// never finished torrent verifies everything that is not ready
+	assert.Equal(t, []uint{3}, verifiedFileIds(db.Torrent{Status: db.TorrentIdle, Files: unselected}))
+	assert.Equal(t, []uint{3}, verifiedFileIds(db.Torrent{Status: db.TorrentError, Files: unselected}))
+
+	// files skipped on purpose are not touched once torrent finished
+	assert.Empty(t, verifiedFileIds(db.Torrent{Status: db.TorrentReady, Files: unselected}))
+	assert.Empty(t, verifiedFileIds(db.Torrent{Status: db.TorrentCleaned, Files: unselected}))
+	assert.Empty(t, verifiedFileIds(db.Torrent{Status: db.TorrentIdle, Seeding: true, Files: unselected}))
+}
+
+func newVerifyTestTorrent(t *testing.T, dataDir string) db.Torrent {
+	require.Nil(t, os.MkdirAll(filepath.Join(dataDir, "show"), 0o755))
+	require.Nil(t, os.WriteFile(filepath.Join(dataDir, "show", "01.mkv"), bytes.Repeat([]byte{1}, 40000), 0o644))
+
+	info := metainfo.Info{PieceLength: 16384}
+	require.Nil(t, info.BuildFromFilePath(filepath.Join(dataDir, "show")))
+	infoBytes, err := bencode.Marshal(info)
+	require.Nil(t, err)
+
+	filePath := filepath.Join(t.TempDir(), "show.torrent")
+	file, err := os.Create(filePath)
+	require.Nil(t, err)
+	require.Nil(t, (&metainfo.MetaInfo{InfoBytes: infoBytes}).Write(file))
+	require.Nil(t, file.Close())
+
+	return db.Torrent{
+		ID:       1,
+		FilePath: filePath,
+		Status:   db.TorrentIdle,
+		Files:    []db.TorrentFile{{ID: 1, Selected: true, Length: 40000}},
+	}
+}
+
+func TestVerifyAfterStop(t *testing.T) {
+	clientConfig := torrentLib.NewDefaultClientConfig()
+	clientConfig.DataDir = t.TempDir()
+	clientConfig.NoDHT = true
+	clientConfig.DisableTrackers = true
+	clientConfig.ListenPort = 0
+	client, err := torrentLib.NewClient(clientConfig)
+	require.Nil(t, err)
+	t.Cleanup(func() { client.Close() })
+
+	s := &TorrentService{
+		log:      zap.NewNop(),
+		client:   client,
+		previews: make(map[*torrentLib.Torrent]int),
+	}
+	torrent := newVerifyTestTorrent(t, clientConfig.DataDir)
+
+	started, err := client.AddTorrentFromFile(torrent.FilePath)
+	require.Nil(t, err)
+	<-started.GotInfo()
+	s.cTorrentMap.Store(torrent.ID, started)
+
+	// Stop removes the handle, so verification adds the torrent again
+	require.True(t, s.dropClientTorrent(torrent.ID))
+	_, exists := s.cTorrentMap.Load(torrent.ID)
+	assert.False(t, exists)
+
+	// previews are not released, since that looks the torrent up in db, client drops them on close
+	cTorrent, _, err := s.acquirePreview(torrent)
+	require.Nil(t, err)
+	assert.NotEqual(t, started, cTorrent)
+	result, err := verifyFiles(cTorrent, torrent.Files, func(int) {})
+	require.Nil(t, err)
+	assert.True(t, result.Complete)
+	cTorrent.Drop()
+
+	// closed handles left in the map are replaced too
+	stale, err := client.AddTorrentFromFile(torrent.FilePath)
+	require.Nil(t, err)
+	<-stale.GotInfo()
+	s.cTorrentMap.Store(torrent.ID, stale)
+	stale.Drop()
+
+	cTorrent, _, err = s.acquirePreview(torrent)
+	require.Nil(t, err)
+	assert.False(t, isClosed(cTorrent))
+	_, err = verifyFiles(cTorrent, torrent.Files, func(int) {})
+	require.Nil(t, err)
+}
@@ -0,0 +1,437 @@
+package service
+
+import (
+	"anileha/config"
+	"anileha/db"
+	"anileha/rest/engine"
+	"anileha/util"
+	"anileha/util/meta"
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"golang.org/x/exp/slices"
+	"gorm.io/datatypes"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	watchTorrentExt   = ".torrent"
+	watchSeriesExt    = ".series"   // watchSeriesExt sidecar "<entry name>.series" holds id of the series that entry is imported into
+	watchProcessedDir = "processed" // watchProcessedDir imported entries are moved into this subfolder of watch dir
+)
+
+type watchRule struct {
+	pattern  *regexp.Regexp
+	seriesId uint
+}
+
+func compileWatchRules(config *config.Config) ([]watchRule, error) {
+	rules := make([]watchRule, 0, len(config.Data.Watch.Rules))
+	for _, rule := range config.Data.Watch.Rules {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", rule.Pattern, err)
+		}
+		rules = append(rules, watchRule{
+			pattern:  pattern,
+			seriesId: rule.SeriesId,
+		})
+	}
+	return rules, nil
+}
+
+// watchEntry Size and modification time of watch dir entry, folders are summed over their files
+type watchEntry struct {
+	size    int64
+	modTime int64
+}
+
+// watchState Entries are imported once they stay unchanged for a whole interval, so that files are not
+// picked up while they are still being copied. Failed entries are not retried until they change
+type watchState struct {
+	seen   map[string]watchEntry
+	failed map[string]watchEntry
+}
+
+// dirWatcher Polls watch dir, dropped .torrent files are added, videos and folders are imported as local torrents
+func (s *TorrentService) dirWatcher(ctx context.Context) {
+	if err := os.MkdirAll(s.config.Data.Watch.Dir, os.ModePerm); err != nil {
+		s.log.Error("failed to create watch dir", zap.Error(err))
+		return
+	}
+	ticker := time.NewTicker(time.Duration(s.config.Data.Watch.IntervalSec) * time.Second)
+	defer ticker.Stop()
+	state := watchState{
+		seen:   make(map[string]watchEntry),
+		failed: make(map[string]watchEntry),
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.scanWatchDir(&state)
+		}
+	}
+}
+
+func (s *TorrentService) scanWatchDir(state *watchState) {
+	dirEntries, err := os.ReadDir(s.config.Data.Watch.Dir)
+	if err != nil {
+		s.log.Error("failed to read watch dir", zap.Error(err))
+		return
+	}
+
+	seen := make(map[string]watchEntry, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		if name == watchProcessedDir || !isWatchedName(name, dirEntry.IsDir()) {
+			continue
+		}
+
+		entryPath := path.Join(s.config.Data.Watch.Dir, name)
+		entry, err := statWatchEntry(entryPath)
+		if err != nil {
+			s.log.Warn("failed to stat watched entry",
+				zap.String("path", entryPath),
+				zap.Error(err))
+			continue
+		}
+		seen[name] = entry
+
+		if previous, exists := state.seen[name]; !exists || previous != entry {
+			continue
+		}
+		if failed, exists := state.failed[name]; exists && failed == entry {
+			continue
+		}
+		delete(state.failed, name)
+
+		err = s.importWatchEntry(entryPath, dirEntry.IsDir())
+		if errors.Is(err, engine.ErrNotEnoughSpace) {
+			s.log.Warn("not enough space to import watched entry, retrying later",
+				zap.String("path", entryPath))
+			continue
+		}
+		if err != nil {
+			s.log.Error("failed to import watched entry",
+				zap.String("path", entryPath),
+				zap.Error(err))
+			state.failed[name] = entry
+		}
+	}
+
+	state.seen = seen
+	for name := range state.failed {
+		if _, exists := seen[name]; !exists {
+			delete(state.failed, name)
+		}
+	}
+}
+
+// isWatchedName Hidden entries, sidecars and files other than .torrent and videos are ignored
+func isWatchedName(name string, isDir bool) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	if isDir {
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == watchTorrentExt || util.GetFileType(name) == util.FileTypeVideo
+}
+
+func statWatchEntry(entryPath string) (watchEntry, error) {
+	entry := watchEntry{}
+	err := filepath.WalkDir(entryPath, func(filePath string, dirEntry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			return err
+		}
+		if !dirEntry.IsDir() {
+			entry.size += info.Size()
+		}
+		if modTime := info.ModTime().UnixNano(); modTime > entry.modTime {
+			entry.modTime = modTime
+		}
+		return nil
+	})
+	return entry, err
+}
+
+// watchSeriesId Sidecar takes precedence over rules, first matching rule wins
+func (s *TorrentService) watchSeriesId(entryPath string) (uint, error) {
+	sidecar, err := os.ReadFile(entryPath + watchSeriesExt)
+	if err == nil {
+		seriesId, err := strconv.ParseUint(strings.TrimSpace(string(sidecar)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid series sidecar: %w", err)
+		}
+		return uint(seriesId), nil
+	}
+	if !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	name := filepath.Base(entryPath)
+	for _, rule := range s.watchRules {
+		if rule.pattern.MatchString(name) {
+			return rule.seriesId, nil
+		}
+	}
+
+	return 0, errors.New("neither series sidecar nor rule matches entry")
+}
+
+func (s *TorrentService) watchAuto() *db.AutoTorrent {
+	if !s.config.Data.Watch.Auto {
+		return nil
+	}
+	return &db.AutoTorrent{
+		AudioLang: s.config.Data.Watch.AudioLang,
+		SubLang:   s.config.Data.Watch.SubLang,
+	}
+}
+
+// importWatchEntry Entry and its sidecar are moved to processed subfolder once they are imported.
+// Failed move is reported as an import error, so that the entry is not imported again on the next scan
+func (s *TorrentService) importWatchEntry(entryPath string, isDir bool) error {
+	seriesId, err := s.watchSeriesId(entryPath)
+	if err != nil {
+		return err
+	}
+
+	if !isDir && strings.ToLower(filepath.Ext(entryPath)) == watchTorrentExt {
+		err = s.importWatchedTorrent(seriesId, entryPath)
+	} else {
+		err = s.importLocal(seriesId, entryPath, isDir)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.moveProcessed(entryPath, isDir); err != nil {
+		return fmt.Errorf("entry was imported, but not moved to processed dir: %w", err)
+	}
+
+	return nil
+}
+
+// moveProcessed Entry that was imported before under the same name is not overwritten, new one gets a suffix
+func (s *TorrentService) moveProcessed(entryPath string, isDir bool) error {
+	processedDir := path.Join(s.config.Data.Watch.Dir, watchProcessedDir)
+	if err := os.MkdirAll(processedDir, os.ModePerm); err != nil {
+		return err
+	}
+
+	name := filepath.Base(entryPath)
+	ext := ""
+	if !isDir {
+		ext = filepath.Ext(name)
+	}
+	processedPath := path.Join(processedDir, name)
+	for i := 1; ; i++ {
+		_, err := os.Lstat(processedPath)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		processedPath = path.Join(processedDir, fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), i, ext))
+	}
+
+	if err := os.Rename(entryPath, processedPath); err != nil {
+		return err
+	}
+	if err := os.Rename(entryPath+watchSeriesExt, processedPath+watchSeriesExt); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// importWatchedTorrent Torrent file is copied to temp dir first, since AddFromFile moves it
+func (s *TorrentService) importWatchedTorrent(seriesId uint, entryPath string) error {
+	tempPath, err := s.fileService.GenTempFilePath(entryPath)
+	if err != nil {
+		return err
+	}
+	if err := linkOrCopy(entryPath, tempPath); err != nil {
+		return err
+	}
+
+	id, err := s.AddFromFile(seriesId, tempPath, s.watchAuto(), nil, nil)
+	if errors.Is(err, engine.ErrTorrentAlreadyExists) {
+		s.fileService.DeleteTempFileAsync(tempPath)
+		s.log.Info("watched torrent already exists",
+			zap.Uint("torrentId", id),
+			zap.String("path", entryPath))
+		return nil
+	}
+	if err != nil {
+		s.fileService.DeleteTempFileAsync(tempPath)
+		return err
+	}
+
+	s.log.Info("added watched torrent",
+		zap.Uint("seriesId", seriesId),
+		zap.Uint("torrentId", id),
+		zap.String("path", entryPath))
+
+	return nil
+}
+
+// localFilePaths Returns paths of entry files relative to the entry, path of a single file is its name
+func localFilePaths(entryPath string) ([]string, error) {
+	paths := make([]string, 0)
+	err := filepath.WalkDir(entryPath, func(filePath string, dirEntry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if dirEntry.IsDir() || strings.HasPrefix(dirEntry.Name(), ".") {
+			return nil
+		}
+		relPath, err := filepath.Rel(entryPath, filePath)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			relPath = dirEntry.Name()
+		}
+		paths = append(paths, filepath.ToSlash(relPath))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// importLocal Copies video file or folder into READY folder of a new local torrent, its files skip downloading
+// and go straight to analysis, so that they are converted the same way as downloaded ones
+func (s *TorrentService) importLocal(seriesId uint, entryPath string, isDir bool) error {
+	filePaths, err := localFilePaths(entryPath)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(filePaths, func(filePath string) bool {
+		return util.GetFileType(filePath) == util.FileTypeVideo
+	}) {
+		return errors.New("no video files found")
+	}
+
+	totalLength := uint(0)
+	lengths := make([]uint, len(filePaths))
+	for i, relPath := range filePaths {
+		srcPath := entryPath
+		if isDir {
+			srcPath = path.Join(entryPath, relPath)
+		}
+		info, err := os.Stat(srcPath)
+		if err != nil {
+			return err
+		}
+		lengths[i] = uint(info.Size())
+		totalLength += lengths[i]
+	}
+
+	fits, err := s.storageService.Fits(int64(totalLength))
+	if err != nil {
+		return err
+	}
+	if !fits {
+		return engine.ErrNotEnoughSpace
+	}
+
+	auto := s.watchAuto()
+	torrent := db.Torrent{
+		SeriesId: &seriesId,
+		Name:     filepath.Base(entryPath),
+		Status:   db.TorrentCreating,
+		Local:    true,
+		Auto:     datatypes.NewJSONType(auto),
+		Release:  datatypes.NewJSONType[*meta.ReleaseInfo](nil),
+	}
+	if _, err := s.torrentRepo.Create(&torrent); err != nil {
+		return err
+	}
+
+	torrentIdStr := strconv.FormatUint(uint64(torrent.ID), 10)
+	torrentReadyRootFolder := path.Join(s.readyFolder, torrentIdStr)
+
+	files := make([]db.TorrentFile, 0, len(filePaths))
+	for i, relPath := range filePaths {
+		srcPath := entryPath
+		if isDir {
+			srcPath = path.Join(entryPath, relPath)
+		}
+
+		newPath, err := s.fileService.GenFilePath(torrentReadyRootFolder, relPath)
+		if err == nil {
+			err = os.MkdirAll(torrentReadyRootFolder, os.ModePerm)
+		}
+		if err == nil {
+			// files are linked, so that nothing is lost if import fails midway
+			err = linkOrCopy(srcPath, newPath)
+		}
+		if err != nil {
+			torrent.Files = files
+			s.onFailedImport(torrent, err)
+			return err
+		}
+
+		files = append(files, db.TorrentFile{
+			TorrentId:         torrent.ID,
+			TorrentIndex:      i,
+			TorrentPath:       relPath,
+			ClientIndex:       i,
+			ReadyPath:         &newPath,
+			Length:            lengths[i],
+			Selected:          true,
+			Status:            db.TorrentFileAnalysis,
+			Type:              util.GetFileType(relPath),
+			SuggestedMetadata: datatypes.NewJSONType(meta.GuessEpisodeMetadata(relPath)),
+		})
+	}
+
+	torrent.Status = db.TorrentAnalysis
+	torrent.TotalLength = totalLength
+	torrent.TotalDownloadLength = totalLength
+	torrent.BytesRead = totalLength
+
+	if err := s.torrentRepo.InitFiles(torrent, files); err != nil {
+		torrent.Files = files
+		s.onFailedImport(torrent, err)
+		return err
+	}
+
+	s.fontService.LoadFonts(context.Background(), files)
+
+	s.publishTorrent(torrent.ID)
+
+	s.log.Info("imported local torrent",
+		zap.Uint("seriesId", seriesId),
+		zap.Uint("torrentId", torrent.ID),
+		zap.String("torrentName", torrent.Name),
+		zap.Int("fileCount", len(files)))
+
+	etaCalc := util.NewEtaCalculator(0, float64(len(files)))
+	etaCalc.Start()
+
+	go s.performAnalysis(torrent.ID, etaCalc)
+
+	return nil
+}
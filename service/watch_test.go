@@ -0,0 +1,62 @@
+package service
+
+import (
+	"anileha/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalFilePaths(t *testing.T) {
+	dir := t.TempDir()
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "Show", "Subs"), os.ModePerm))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "Show", "02.mkv"), nil, 0644))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "Show", "01.mkv"), nil, 0644))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "Show", "Subs", "01.ass"), nil, 0644))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "Show", ".hidden"), nil, 0644))
+
+	paths, err := localFilePaths(filepath.Join(dir, "Show"))
+	require.Nil(t, err)
+	assert.Equal(t, []string{"01.mkv", "02.mkv", "Subs/01.ass"}, paths)
+
+	// single file is named after itself
+	paths, err = localFilePaths(filepath.Join(dir, "Show", "01.mkv"))
+	require.Nil(t, err)
+	assert.Equal(t, []string{"01.mkv"}, paths)
+}
+
+func TestIsWatchedName(t *testing.T) {
+	assert.True(t, isWatchedName("show.torrent", false))
+	assert.True(t, isWatchedName("Show - 01.mkv", false))
+	assert.True(t, isWatchedName("Show", true))
+	assert.False(t, isWatchedName("Show - 01.mkv.series", false))
+	assert.False(t, isWatchedName("notes.txt", false))
+	assert.False(t, isWatchedName(".partial.mkv", false))
+}
+
+func TestMoveProcessed(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.GetDefaultConfig()
+	cfg.Data.Watch.Dir = dir
+	service := &TorrentService{config: &cfg}
+
+	for i := 0; i < 2; i++ {
+		require.Nil(t, os.WriteFile(filepath.Join(dir, "01.mkv"), []byte{byte(i)}, 0644))
+		require.Nil(t, os.WriteFile(filepath.Join(dir, "01.mkv.series"), []byte("1"), 0644))
+		require.Nil(t, service.moveProcessed(filepath.Join(dir, "01.mkv"), false))
+	}
+
+	// earlier imports are kept, entries never leave watch dir
+	processed, err := os.ReadDir(filepath.Join(dir, watchProcessedDir))
+	require.Nil(t, err)
+	names := make([]string, 0, len(processed))
+	for _, entry := range processed {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{"01.mkv", "01.mkv.series", "01 (1).mkv", "01 (1).mkv.series"}, names)
+
+	_, err = os.Stat(filepath.Join(dir, "01.mkv"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -11,3 +11,5 @@ var ErrUnknownByteLengthStr = errors.New("unknown byte length string")
 var ErrMoreThanOneVideoStream = errors.New("found more than one video stream")
 var ErrVideoStreamNotFound = errors.New("video stream not found")
 var ErrUnsupportedSubs = errors.New("unsupported subs")
+var ErrUnknownProvider = errors.New("unknown search provider")
+var ErrUnknownMetadataProvider = errors.New("unknown metadata provider")
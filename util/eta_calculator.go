@@ -64,6 +64,18 @@ func (c *EtaCalculator) ContinueWithNewValues(startValue float64, endValue float
 	c.lastTime = time.Now()
 }
 
+// Rebase Replaces current and end values without affecting approximated speed,
+// used when amount of work changes on the fly
+func (c *EtaCalculator) Rebase(value float64, endValue float64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.lastValue = value
+	c.endValue = endValue
+	c.isFinished = false
+	c.lastTime = time.Now()
+}
+
 func (c *EtaCalculator) Update(newValue float64) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
@@ -28,6 +28,26 @@ var sEpRegex = regexp.MustCompile("(?i)ep\\s*(\\d+)")
 var sSeasonRegex = regexp.MustCompile("(?i)season\\s*(\\d+)")
 var sSxERegex = regexp.MustCompile("(?i)(\\d+)\\s*x\\s*(\\d+)")
 var eDotSpaceRegex = regexp.MustCompile("(?i)(\\d+)\\.\\s")
+var episodeNumberRegex = regexp.MustCompile("^\\d+(?:\\.\\d+)?")
+
+// EpisodeNumber Returns numeric value of the episode, if it starts with a number
+func (m EpisodeMetadata) EpisodeNumber() (float64, bool) {
+	numberStr := episodeNumberRegex.FindString(strings.TrimSpace(m.Episode))
+	if numberStr == "" {
+		return 0, false
+	}
+	number, err := strconv.ParseFloat(numberStr, 64)
+	if err != nil {
+		return 0, false
+	}
+	return number, true
+}
+
+// GuessTitleMetadata Same as GuessEpisodeMetadata, but for release titles, which are not file paths
+func GuessTitleMetadata(title string) EpisodeMetadata {
+	// prevent slashes and dots in title from being treated as directories or extension
+	return GuessEpisodeMetadata(strings.ReplaceAll(title, "/", " ") + ".mkv")
+}
 
 func GuessEpisodeMetadata(filename string) EpisodeMetadata {
 	var resultSeason string
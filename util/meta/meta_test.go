@@ -207,3 +207,24 @@ func TestSingleEpisodeMetadata34(t *testing.T) {
 	assert.Equal(t, metadata.Season, "Sayonara Zetsubou Sensei")
 	assert.Equal(t, metadata.Episode, "BD Special")
 }
+
+func TestTitleMetadata1(t *testing.T) {
+	metadata := GuessTitleMetadata("[SubsPlease] Dr. Stone S3 - 05 (1080p) [ABCD1234]")
+	assert.Equal(t, metadata.Season, "Dr. Stone S3")
+	assert.Equal(t, metadata.Episode, "05")
+}
+
+func TestTitleMetadata2(t *testing.T) {
+	metadata := GuessTitleMetadata("[SubsPlease] Fate/Zero - 13 (1080p) [ABCD1234].mkv")
+	assert.Equal(t, metadata.Season, "Fate Zero")
+	assert.Equal(t, metadata.Episode, "13")
+}
+
+func TestEpisodeNumber(t *testing.T) {
+	number, ok := EpisodeMetadata{Episode: "07.5"}.EpisodeNumber()
+	assert.Equal(t, ok, true)
+	assert.Equal(t, number, 7.5)
+
+	_, ok = EpisodeMetadata{Episode: "NCED01"}.EpisodeNumber()
+	assert.Equal(t, ok, false)
+}
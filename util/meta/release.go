@@ -0,0 +1,75 @@
+package meta
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ReleaseInfo Represents info about a single release parsed from its title
+type ReleaseInfo struct {
+	Episode    string `json:"episode"`
+	Group      string `json:"group"`
+	Resolution string `json:"resolution"`
+	Codec      string `json:"codec"`
+	Version    int    `json:"version"`
+}
+
+var groupRegex = regexp.MustCompile("^\\s*\\[([^]]+)]")
+var resolutionRegex = regexp.MustCompile("(?i)\\b(\\d{3,4})p\\b")
+var dimensionsRegex = regexp.MustCompile("(?i)\\b\\d{3,4}\\s*x\\s*(\\d{3,4})\\b")
+var uhdRegex = regexp.MustCompile("(?i)\\b4k\\b")
+var versionRegex = regexp.MustCompile("(?i)(?:\\d|\\b)v(\\d{1,2})\\b")
+var episodeVersionRegex = regexp.MustCompile("(?i)(\\d)v\\d{1,2}\\b")
+
+var codecRegexes = []struct {
+	codec string
+	regex *regexp.Regexp
+}{
+	{"hevc", regexp.MustCompile("(?i)\\b(?:hevc|[xh]\\.?265)\\b")},
+	{"avc", regexp.MustCompile("(?i)\\b(?:avc|[xh]\\.?264)\\b")},
+	{"av1", regexp.MustCompile("(?i)\\bav1\\b")},
+}
+
+// ParseRelease Extracts episode, release group, resolution, codec and version from release title
+func ParseRelease(title string) ReleaseInfo {
+	info := ReleaseInfo{
+		Version: 1,
+	}
+
+	if test := groupRegex.FindStringSubmatch(title); test != nil {
+		info.Group = strings.TrimSpace(test[1])
+	}
+
+	if test := resolutionRegex.FindStringSubmatch(title); test != nil {
+		info.Resolution = test[1] + "p"
+	} else if test := dimensionsRegex.FindStringSubmatch(title); test != nil {
+		info.Resolution = test[1] + "p"
+	} else if uhdRegex.MatchString(title) {
+		info.Resolution = "2160p"
+	}
+
+	for _, entry := range codecRegexes {
+		if entry.regex.MatchString(title) {
+			info.Codec = entry.codec
+			break
+		}
+	}
+
+	if test := versionRegex.FindStringSubmatch(title); test != nil {
+		info.Version, _ = strconv.Atoi(test[1])
+	}
+
+	// version suffix (e.g. 05v2) confuses episode guessing
+	info.Episode = GuessTitleMetadata(episodeVersionRegex.ReplaceAllString(title, "$1")).Episode
+
+	return info
+}
+
+// EpisodeKey Returns normalized episode, so that different releases of the same episode could be compared
+func (r ReleaseInfo) EpisodeKey() string {
+	if number, ok := (EpisodeMetadata{Episode: r.Episode}).EpisodeNumber(); ok {
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	return strings.ToLower(strings.TrimSpace(r.Episode))
+}
@@ -0,0 +1,34 @@
+package meta
+
+import (
+	"github.com/go-playground/assert/v2"
+	"testing"
+)
+
+func TestRelease1(t *testing.T) {
+	release := ParseRelease("[SubsPlease] Vinland Saga S2 - 13v2 (1080p) [0C1D2E3F].mkv")
+	assert.Equal(t, release.Group, "SubsPlease")
+	assert.Equal(t, release.Episode, "13")
+	assert.Equal(t, release.Resolution, "1080p")
+	assert.Equal(t, release.Codec, "")
+	assert.Equal(t, release.Version, 2)
+	assert.Equal(t, release.EpisodeKey(), "13")
+}
+
+func TestRelease2(t *testing.T) {
+	release := ParseRelease("[ASW] Jigokuraku - 01 [1080p HEVC x265 10Bit][AAC]")
+	assert.Equal(t, release.Group, "ASW")
+	assert.Equal(t, release.Episode, "01")
+	assert.Equal(t, release.Resolution, "1080p")
+	assert.Equal(t, release.Codec, "hevc")
+	assert.Equal(t, release.Version, 1)
+	assert.Equal(t, release.EpisodeKey(), "1")
+}
+
+func TestRelease3(t *testing.T) {
+	release := ParseRelease("[Erai-raws] Blue Lock - 24 END [1920x1080 H.264][Multiple Subtitle]")
+	assert.Equal(t, release.Group, "Erai-raws")
+	assert.Equal(t, release.Episode, "24")
+	assert.Equal(t, release.Resolution, "1080p")
+	assert.Equal(t, release.Codec, "avc")
+}